@@ -1,6 +1,11 @@
 package evaluator
 
-import "expr/parser"
+import (
+	"expr/parser"
+	"math/big"
+	"sync"
+	"time"
+)
 
 type ObjType int
 
@@ -11,15 +16,26 @@ type Object interface {
 const (
 	TIdentObj ObjType = iota
 	TIntegerObj
+	TBigIntObj
 	TFloatObj
 	TBooleanObj
 	TStringObj
+	TTimeObj
+	TDurationObj
 	TTableObj
 	TPackObj
 	TFuncObj
+	TNativeFuncObj
 	TNilObj
+	TErrorObj
+	TGeneratorObj
+	TCoroutineObj
+	TTaskObj
+	TChanObj
+	TWaitGroupObj
 	TReturnObj
 	TBreakObj
+	TTailCallObj
 )
 
 func (t ObjType) String() string {
@@ -28,22 +44,46 @@ func (t ObjType) String() string {
 		return "TIdentObj"
 	case TIntegerObj:
 		return "TIntegerObj"
+	case TBigIntObj:
+		return "TBigIntObj"
 	case TFloatObj:
 		return "TFloatObj"
 	case TBooleanObj:
 		return "TBooleanObj"
 	case TStringObj:
 		return "TStringObj"
+	case TTimeObj:
+		return "TTimeObj"
+	case TDurationObj:
+		return "TDurationObj"
 	case TTableObj:
 		return "TTableObj"
 	case TPackObj:
 		return "TPackObj"
+	case TFuncObj:
+		return "TFuncObj"
+	case TNativeFuncObj:
+		return "TNativeFuncObj"
 	case TNilObj:
 		return "TNilObj"
+	case TErrorObj:
+		return "TErrorObj"
+	case TGeneratorObj:
+		return "TGeneratorObj"
+	case TCoroutineObj:
+		return "TCoroutineObj"
+	case TTaskObj:
+		return "TTaskObj"
+	case TChanObj:
+		return "TChanObj"
+	case TWaitGroupObj:
+		return "TWaitGroupObj"
 	case TReturnObj:
 		return "TReturnObj"
 	case TBreakObj:
 		return "TBreakObj"
+	case TTailCallObj:
+		return "TTailCallObj"
 	default:
 		panic("func (t ObjType) String() string")
 	}
@@ -65,6 +105,15 @@ func (o IntegerObj) Type() ObjType {
 	return TIntegerObj
 }
 
+// 超出 int64 范围的整数，Value 不可修改
+type BigIntObj struct {
+	Value *big.Int
+}
+
+func (o BigIntObj) Type() ObjType {
+	return TBigIntObj
+}
+
 type FloatObj struct {
 	Value float64
 }
@@ -89,11 +138,42 @@ func (o StringObj) Type() ObjType {
 	return TStringObj
 }
 
+type TimeObj struct {
+	Value time.Time
+}
+
+func (o TimeObj) Type() ObjType {
+	return TTimeObj
+}
+
+type DurationObj struct {
+	Value time.Duration
+}
+
+func (o DurationObj) Type() ObjType {
+	return TDurationObj
+}
+
 //引用类型
 
 type TableValue struct {
-	Store map[Object]Object
+	Store  map[Object]Object
+	Meta   *TableValue
+	frozen bool           // 被冻结的环境引用的表只读，可以被多个 goroutine 同时访问
+	seq    map[Object]int // 非数字、字符串、布尔值的键的插入序号，决定它们的遍历顺序
+}
+
+// 写入键值并记录键的插入顺序
+func (t *TableValue) set(key Object, value Object) {
+	if _, ok := t.Store[key]; !ok && keyTypeRank(key) == 3 {
+		if t.seq == nil {
+			t.seq = make(map[Object]int)
+		}
+		t.seq[key] = len(t.seq)
+	}
+	t.Store[key] = value
 }
+
 type TableObj struct {
 	Table *TableValue
 }
@@ -114,9 +194,10 @@ func (t PackObj) Type() ObjType {
 }
 
 type FuncValue struct {
-	FuncEnv    *Environment
-	Parameters []*parser.Identifier
-	Body       *parser.BlockExpr
+	FuncEnv     *Environment
+	Parameters  []*parser.Parameter
+	Body        *parser.BlockExpr
+	IsGenerator bool
 }
 type FuncObj struct {
 	Func *FuncValue
@@ -126,6 +207,20 @@ func (f FuncObj) Type() ObjType {
 	return TFuncObj
 }
 
+type NativeFunc func(args []Object) (Object, *EvalError)
+
+type NativeFuncValue struct {
+	Name string
+	Fn   NativeFunc
+}
+type NativeFuncObj struct {
+	Func *NativeFuncValue
+}
+
+func (f NativeFuncObj) Type() ObjType {
+	return TNativeFuncObj
+}
+
 type NilValue struct{}
 
 var NilObj Object = NilValue{}
@@ -134,6 +229,86 @@ func (o NilValue) Type() ObjType {
 	return TNilObj
 }
 
+// throw 抛出或 catch 捕获的错误，字段 message data traceback 可以在脚本中读取
+type ErrorValue struct {
+	Message   string
+	Data      Object
+	Traceback []string
+}
+type ErrorObj struct {
+	Err *ErrorValue
+}
+
+func (o ErrorObj) Type() ObjType {
+	return TErrorObj
+}
+
+// 调用含有 yield 的函数得到的迭代器
+type GeneratorValue struct {
+	co *coroutine
+}
+type GeneratorObj struct {
+	Gen *GeneratorValue
+}
+
+func (o GeneratorObj) Type() ObjType {
+	return TGeneratorObj
+}
+
+// coroutine.create 创建的协程
+type CoroutineValue struct {
+	co *coroutine
+}
+type CoroutineObj struct {
+	Co *CoroutineValue
+}
+
+func (o CoroutineObj) Type() ObjType {
+	return TCoroutineObj
+}
+
+// spawn 返回的任务句柄
+type TaskValue struct {
+	t *task
+}
+type TaskObj struct {
+	Task *TaskValue
+}
+
+func (o TaskObj) Type() ObjType {
+	return TTaskObj
+}
+
+// chan(n) 创建的通道
+type ChanValue struct {
+	in     *Interpreter
+	ch     chan Object
+	mu     sync.Mutex
+	closed bool
+}
+type ChanObj struct {
+	Chan *ChanValue
+}
+
+func (o ChanObj) Type() ObjType {
+	return TChanObj
+}
+
+// waitgroup() 创建的等待组
+type WaitGroupValue struct {
+	in   *Interpreter
+	mu   sync.Mutex
+	n    int64
+	zero chan struct{} // 计数为 0 时处于关闭状态
+}
+type WaitGroupObj struct {
+	WaitGroup *WaitGroupValue
+}
+
+func (o WaitGroupObj) Type() ObjType {
+	return TWaitGroupObj
+}
+
 //包装类型
 
 type ReturnObj struct {
@@ -151,3 +326,21 @@ type BreakObj struct {
 func (o BreakObj) Type() ObjType {
 	return TBreakObj
 }
+
+// 按名字传参时跳过的位置，绑定参数时按缺少的参数处理
+type missingArg struct{}
+
+func (o missingArg) Type() ObjType {
+	return TNilObj
+}
+
+// 尾调用 return f(x) 的返回值，由调用方在同一层 Go 栈中继续调用
+type tailCallObj struct {
+	in   *Interpreter // 发起尾调用的解释器
+	fn   Object
+	args []Object
+}
+
+func (o tailCallObj) Type() ObjType {
+	return TTailCallObj
+}
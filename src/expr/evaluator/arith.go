@@ -0,0 +1,141 @@
+package evaluator
+
+import (
+	"expr/lexer"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+func operatorString(op lexer.TokenType) string {
+	switch op {
+	case lexer.T_PLUS:
+		return "+"
+	case lexer.T_MINUS:
+		return "-"
+	case lexer.T_ASTERISK:
+		return "*"
+	case lexer.T_SLASH:
+		return "/"
+	case lexer.T_LT:
+		return "<"
+	case lexer.T_LE:
+		return "<="
+	case lexer.T_GT:
+		return ">"
+	case lexer.T_GE:
+		return ">="
+	case lexer.T_EQ:
+		return "=="
+	case lexer.T_NEQ:
+		return "!="
+	case lexer.T_PERCENT:
+		return "%"
+	case lexer.T_POWER:
+		return "**"
+	case lexer.T_DOUBLE_SLASH:
+		return "//"
+	case lexer.T_AMPERSAND:
+		return "&"
+	case lexer.T_PIPE:
+		return "|"
+	case lexer.T_CARET:
+		return "^"
+	case lexer.T_SHL:
+		return "<<"
+	case lexer.T_SHR:
+		return ">>"
+	case lexer.T_TILDE:
+		return "~"
+	default:
+		return op.String()
+	}
+}
+
+func isNumberObj(obj Object) bool {
+	return obj.Type() == TIntegerObj || obj.Type() == TFloatObj || obj.Type() == TBigIntObj
+}
+
+// % // ** 运算，整数取模和整除均向下取整，满足 a == (a // b) * b + a % b
+func evalNumberInfix(op lexer.TokenType, left Object, right Object) (Object, *EvalError) {
+	if !isNumberObj(left) || !isNumberObj(right) {
+		return nil, &EvalError{Message: fmt.Sprintf("operator %s with wrong value type %s and %s",
+			operatorString(op), left.Type(), right.Type())}
+	}
+	if left.Type() == TBigIntObj || right.Type() == TBigIntObj {
+		obj, _, err := evalBigIntInfix(op, left, right)
+		return obj, err
+	}
+	if left.Type() == TIntegerObj && right.Type() == TIntegerObj {
+		l, r := left.(IntegerObj).Value, right.(IntegerObj).Value
+		switch op {
+		case lexer.T_PERCENT, lexer.T_DOUBLE_SLASH:
+			if r == 0 {
+				return nil, &EvalError{Message: fmt.Sprintf("integer divide by zero in operator %s", operatorString(op))}
+			}
+			if l == math.MinInt64 && r == -1 {
+				obj, _, err := evalBigIntInfix(op, BigIntObj{Value: big.NewInt(l)}, right)
+				return obj, err
+			}
+			q, m := l/r, l%r
+			if m != 0 && (m < 0) != (r < 0) {
+				q, m = q-1, m+r
+			}
+			if op == lexer.T_PERCENT {
+				return IntegerObj{Value: m}, nil
+			}
+			return IntegerObj{Value: q}, nil
+		case lexer.T_POWER:
+			if r < 0 {
+				return FloatObj{Value: math.Pow(float64(l), float64(r))}, nil
+			}
+			return checkedPow(l, r)
+		}
+	}
+	l, r := toFloatObj(left).Value, toFloatObj(right).Value
+	switch op {
+	case lexer.T_PERCENT:
+		m := math.Mod(l, r)
+		if m != 0 && (m < 0) != (r < 0) {
+			m += r
+		}
+		return FloatObj{Value: m}, nil
+	case lexer.T_DOUBLE_SLASH:
+		return FloatObj{Value: math.Floor(l / r)}, nil
+	case lexer.T_POWER:
+		return FloatObj{Value: math.Pow(l, r)}, nil
+	}
+	return nil, &EvalError{Message: fmt.Sprintf("unknown number operator %s", operatorString(op))}
+}
+
+func evalBitwiseInfix(op lexer.TokenType, left Object, right Object) (Object, *EvalError) {
+	if (left.Type() == TBigIntObj || right.Type() == TBigIntObj) &&
+		left.Type() != TFloatObj && right.Type() != TFloatObj {
+		if obj, ok, err := evalBigIntInfix(op, left, right); ok {
+			return obj, err
+		}
+	}
+	l, lok := left.(IntegerObj)
+	r, rok := right.(IntegerObj)
+	if !lok || !rok {
+		return nil, &EvalError{Message: fmt.Sprintf("bitwise operator %s requires integer operands, got %s and %s",
+			operatorString(op), left.Type(), right.Type())}
+	}
+	switch op {
+	case lexer.T_AMPERSAND:
+		return IntegerObj{Value: l.Value & r.Value}, nil
+	case lexer.T_PIPE:
+		return IntegerObj{Value: l.Value | r.Value}, nil
+	case lexer.T_CARET:
+		return IntegerObj{Value: l.Value ^ r.Value}, nil
+	case lexer.T_SHL, lexer.T_SHR:
+		if r.Value < 0 {
+			return nil, &EvalError{Message: fmt.Sprintf("negative shift count %d", r.Value)}
+		}
+		if op == lexer.T_SHL {
+			return checkedShl(l.Value, r.Value)
+		}
+		return IntegerObj{Value: l.Value >> uint64(r.Value)}, nil
+	}
+	return nil, &EvalError{Message: fmt.Sprintf("unknown bitwise operator %s", operatorString(op))}
+}
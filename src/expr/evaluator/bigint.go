@@ -0,0 +1,227 @@
+package evaluator
+
+import (
+	"expr/lexer"
+	"fmt"
+	"math"
+	"math/big"
+)
+
+// int64 运算溢出时透明提升为 BigIntObj，结果能放进 int64 时再降回 IntegerObj
+
+func normalizeBigInt(v *big.Int) Object {
+	if v.IsInt64() {
+		return IntegerObj{Value: v.Int64()}
+	}
+	return BigIntObj{Value: v}
+}
+
+func toBigInt(obj Object) (*big.Int, bool) {
+	switch obj := obj.(type) {
+	case IntegerObj:
+		return big.NewInt(obj.Value), true
+	case BigIntObj:
+		return obj.Value, true
+	default:
+		return nil, false
+	}
+}
+
+func bigIntToFloat(v *big.Int) float64 {
+	f, _ := new(big.Float).SetInt(v).Float64()
+	return f
+}
+
+func checkedAdd(l int64, r int64) Object {
+	s := l + r
+	if (l >= 0) == (r >= 0) && (s >= 0) != (l >= 0) {
+		return normalizeBigInt(new(big.Int).Add(big.NewInt(l), big.NewInt(r)))
+	}
+	return IntegerObj{Value: s}
+}
+
+func checkedSub(l int64, r int64) Object {
+	d := l - r
+	if (l >= 0) != (r >= 0) && (d >= 0) != (l >= 0) {
+		return normalizeBigInt(new(big.Int).Sub(big.NewInt(l), big.NewInt(r)))
+	}
+	return IntegerObj{Value: d}
+}
+
+func checkedMul(l int64, r int64) Object {
+	if l == 0 || r == 0 {
+		return IntegerObj{Value: 0}
+	}
+	p := l * r
+	if p/r != l || (l == -1 && r == math.MinInt64) || (r == -1 && l == math.MinInt64) {
+		return normalizeBigInt(new(big.Int).Mul(big.NewInt(l), big.NewInt(r)))
+	}
+	return IntegerObj{Value: p}
+}
+
+func checkedNeg(v int64) Object {
+	if v == math.MinInt64 {
+		return normalizeBigInt(new(big.Int).Neg(big.NewInt(v)))
+	}
+	return IntegerObj{Value: -v}
+}
+
+// 大整数运算结果的最大位数，** 和 << 在计算之前按此估算，避免一个表达式耗尽内存和时间
+const maxBigIntBits = 1 << 22
+
+// 调用者保证 exp >= 0
+func checkedPow(base int64, exp int64) (Object, *EvalError) {
+	result := int64(1)
+	b := base
+	for e := exp; e > 0; e >>= 1 {
+		if e&1 == 1 {
+			r, ok := checkedMul(result, b).(IntegerObj)
+			if !ok {
+				return bigPow(big.NewInt(base), exp)
+			}
+			result = r.Value
+		}
+		if e > 1 {
+			bb, ok := checkedMul(b, b).(IntegerObj)
+			if !ok {
+				return bigPow(big.NewInt(base), exp)
+			}
+			b = bb.Value
+		}
+	}
+	return IntegerObj{Value: result}, nil
+}
+
+// 结果的位数不超过 exp * l.BitLen()，调用者保证 exp >= 0
+func bigPow(l *big.Int, exp int64) (Object, *EvalError) {
+	if bits := int64(l.BitLen()); bits > 1 && exp > maxBigIntBits/bits {
+		return nil, &EvalError{Message: "result of operator ** too large"}
+	}
+	return normalizeBigInt(new(big.Int).Exp(l, big.NewInt(exp), nil)), nil
+}
+
+// 调用者保证 n >= 0
+func checkedShl(l int64, n int64) (Object, *EvalError) {
+	if l == 0 {
+		return IntegerObj{Value: 0}, nil
+	}
+	if n < 63 {
+		s := l << uint64(n)
+		if s>>uint64(n) == l {
+			return IntegerObj{Value: s}, nil
+		}
+	}
+	return bigShl(big.NewInt(l), n)
+}
+
+// 结果的位数为 l.BitLen() + n，调用者保证 n >= 0
+func bigShl(l *big.Int, n int64) (Object, *EvalError) {
+	if l.Sign() == 0 {
+		return IntegerObj{Value: 0}, nil
+	}
+	if n > maxBigIntBits-int64(l.BitLen()) {
+		return nil, &EvalError{Message: "result of operator << too large"}
+	}
+	return normalizeBigInt(new(big.Int).Lsh(l, uint(n))), nil
+}
+
+// 向下取整的除法和取模，和 int64 的 // % 语义一致
+func bigFloorDivMod(l *big.Int, r *big.Int) (*big.Int, *big.Int) {
+	q, m := new(big.Int).QuoRem(l, r, new(big.Int))
+	if m.Sign() != 0 && m.Sign() != r.Sign() {
+		q.Sub(q, big.NewInt(1))
+		m.Add(m, r)
+	}
+	return q, m
+}
+
+// 处理至少一个操作数为 BigIntObj 的运算，ok 为 false 表示不支持该操作数组合
+func evalBigIntInfix(op lexer.TokenType, left Object, right Object) (Object, bool, *EvalError) {
+	if left.Type() == TFloatObj || right.Type() == TFloatObj {
+		if !isNumberObj(left) || !isNumberObj(right) {
+			return nil, false, nil
+		}
+		obj, err := evalInfixOperator(nil, op, toFloatObj(left), toFloatObj(right))
+		return obj, true, err
+	}
+	l, lok := toBigInt(left)
+	r, rok := toBigInt(right)
+	if !lok || !rok {
+		return nil, false, nil
+	}
+	divCheck := func() *EvalError {
+		if r.Sign() == 0 {
+			return &EvalError{Message: fmt.Sprintf("integer divide by zero in operator %s", operatorString(op))}
+		}
+		return nil
+	}
+	switch op {
+	case lexer.T_PLUS:
+		return normalizeBigInt(new(big.Int).Add(l, r)), true, nil
+	case lexer.T_MINUS:
+		return normalizeBigInt(new(big.Int).Sub(l, r)), true, nil
+	case lexer.T_ASTERISK:
+		return normalizeBigInt(new(big.Int).Mul(l, r)), true, nil
+	case lexer.T_SLASH:
+		if err := divCheck(); err != nil {
+			return nil, true, err
+		}
+		return normalizeBigInt(new(big.Int).Quo(l, r)), true, nil
+	case lexer.T_DOUBLE_SLASH, lexer.T_PERCENT:
+		if err := divCheck(); err != nil {
+			return nil, true, err
+		}
+		q, m := bigFloorDivMod(l, r)
+		if op == lexer.T_PERCENT {
+			return normalizeBigInt(m), true, nil
+		}
+		return normalizeBigInt(q), true, nil
+	case lexer.T_POWER:
+		if !r.IsInt64() {
+			return nil, true, &EvalError{Message: "exponent of operator ** too large"}
+		}
+		if r.Sign() < 0 {
+			return FloatObj{Value: math.Pow(bigIntToFloat(l), bigIntToFloat(r))}, true, nil
+		}
+		obj, err := bigPow(l, r.Int64())
+		return obj, true, err
+	case lexer.T_AMPERSAND:
+		return normalizeBigInt(new(big.Int).And(l, r)), true, nil
+	case lexer.T_PIPE:
+		return normalizeBigInt(new(big.Int).Or(l, r)), true, nil
+	case lexer.T_CARET:
+		return normalizeBigInt(new(big.Int).Xor(l, r)), true, nil
+	case lexer.T_SHL, lexer.T_SHR:
+		if !r.IsInt64() || r.Int64() > math.MaxInt32 {
+			return nil, true, &EvalError{Message: fmt.Sprintf("shift count of operator %s too large", operatorString(op))}
+		}
+		if r.Sign() < 0 {
+			return nil, true, &EvalError{Message: fmt.Sprintf("negative shift count %s", r.String())}
+		}
+		if op == lexer.T_SHL {
+			obj, err := bigShl(l, r.Int64())
+			return obj, true, err
+		}
+		return normalizeBigInt(new(big.Int).Rsh(l, uint(r.Int64()))), true, nil
+	case lexer.T_LT:
+		return BooleanObj{Value: l.Cmp(r) < 0}, true, nil
+	case lexer.T_LE:
+		return BooleanObj{Value: l.Cmp(r) <= 0}, true, nil
+	case lexer.T_GT:
+		return BooleanObj{Value: l.Cmp(r) > 0}, true, nil
+	case lexer.T_GE:
+		return BooleanObj{Value: l.Cmp(r) >= 0}, true, nil
+	case lexer.T_EQ:
+		return BooleanObj{Value: l.Cmp(r) == 0}, true, nil
+	case lexer.T_NEQ:
+		return BooleanObj{Value: l.Cmp(r) != 0}, true, nil
+	}
+	return nil, false, nil
+}
+
+func checkTableKey(key Object) *EvalError {
+	if key.Type() == TBigIntObj {
+		return &EvalError{Message: "big integer can't be used as table key"}
+	}
+	return nil
+}
@@ -0,0 +1,256 @@
+package evaluator
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+	"unicode/utf8"
+)
+
+var builtins = map[string]Object{}
+
+func init() {
+	registerBuiltin("print", builtinPrint)
+	registerBuiltin("tostring", builtinToString)
+	registerBuiltin("len", builtinLen)
+	registerBuiltin("setmeta", builtinSetMeta)
+	registerBuiltin("getmeta", builtinGetMeta)
+	registerBuiltin("error", builtinError)
+}
+
+func registerBuiltin(name string, fn NativeFunc) {
+	builtins[name] = NewNativeFunc(name, fn)
+}
+
+func NewNativeFunc(name string, fn NativeFunc) NativeFuncObj {
+	return NativeFuncObj{Func: &NativeFuncValue{Name: name, Fn: fn}}
+}
+
+func checkNArgs(name string, args []Object, n int) *EvalError {
+	if len(args) < n {
+		return &EvalError{Message: fmt.Sprintf("%s: expect %d arguments, got %d", name, n, len(args))}
+	}
+	return nil
+}
+
+func argTypeError(name string, i int, expect string, got Object) *EvalError {
+	return &EvalError{Message: fmt.Sprintf("%s: argument #%d expect %s, got %s", name, i+1, expect, got.Type())}
+}
+
+func argMissingError(name string, i int, expect string) *EvalError {
+	return &EvalError{Message: fmt.Sprintf("%s: argument #%d expect %s, got nothing", name, i+1, expect)}
+}
+
+// 第 i 个参数存在且不为 nil
+func hasArg(args []Object, i int) bool {
+	return i < len(args) && args[i] != NilObj
+}
+
+func argString(name string, args []Object, i int) (string, *EvalError) {
+	if i >= len(args) {
+		return "", argMissingError(name, i, "string")
+	}
+	if s, ok := args[i].(StringObj); ok {
+		return s.Value, nil
+	}
+	return "", argTypeError(name, i, "string", args[i])
+}
+
+func argInteger(name string, args []Object, i int) (int64, *EvalError) {
+	if i >= len(args) {
+		return 0, argMissingError(name, i, "integer")
+	}
+	if n, ok := args[i].(IntegerObj); ok {
+		return n.Value, nil
+	}
+	return 0, argTypeError(name, i, "integer", args[i])
+}
+
+func argNumber(name string, args []Object, i int) (float64, *EvalError) {
+	if i >= len(args) {
+		return 0, argMissingError(name, i, "number")
+	}
+	if isNumberObj(args[i]) {
+		return toFloatObj(args[i]).Value, nil
+	}
+	return 0, argTypeError(name, i, "number", args[i])
+}
+
+func argPack(name string, args []Object, i int) (*PackValue, *EvalError) {
+	if i >= len(args) {
+		return nil, argMissingError(name, i, "pack")
+	}
+	if p, ok := args[i].(PackObj); ok {
+		return p.Pack, nil
+	}
+	return nil, argTypeError(name, i, "pack", args[i])
+}
+
+func argTable(name string, args []Object, i int) (*TableValue, *EvalError) {
+	if i >= len(args) {
+		return nil, argMissingError(name, i, "table")
+	}
+	if t, ok := args[i].(TableObj); ok {
+		return t.Table, nil
+	}
+	return nil, argTypeError(name, i, "table", args[i])
+}
+
+func builtinPrint(args []Object) (Object, *EvalError) {
+	buf := bytes.Buffer{}
+	for i, arg := range args {
+		if i != 0 {
+			buf.WriteString("\t")
+		}
+		s, err := toString(arg)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString(s)
+	}
+	buf.WriteString("\n")
+	_, _ = os.Stdout.Write(buf.Bytes())
+	return NilObj, nil
+}
+
+func builtinToString(args []Object) (Object, *EvalError) {
+	if err := checkNArgs("tostring", args, 1); err != nil {
+		return nil, err
+	}
+	s, err := toString(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return StringObj{Value: s}, nil
+}
+
+func builtinLen(args []Object) (Object, *EvalError) {
+	if err := checkNArgs("len", args, 1); err != nil {
+		return nil, err
+	}
+	switch obj := args[0].(type) {
+	case StringObj:
+		return IntegerObj{Value: int64(utf8.RuneCountInString(obj.Value))}, nil
+	case PackObj:
+		return IntegerObj{Value: int64(len(obj.Pack.Objs))}, nil
+	case TableObj:
+		if h := getMetaMethod(obj, "__len"); h != nil {
+			return callFunction(nil, h, []Object{obj})
+		}
+		return IntegerObj{Value: int64(len(obj.Table.Store))}, nil
+	default:
+		return nil, &EvalError{Message: fmt.Sprintf("len: wrong argument type %s", obj.Type())}
+	}
+}
+
+func builtinSetMeta(args []Object) (Object, *EvalError) {
+	if err := checkNArgs("setmeta", args, 2); err != nil {
+		return nil, err
+	}
+	table, ok := args[0].(TableObj)
+	if !ok {
+		return nil, &EvalError{Message: fmt.Sprintf("setmeta: first argument must be table, got %s", args[0].Type())}
+	}
+	if table.Table.frozen {
+		return nil, &EvalError{Message: "setmeta: table is frozen"}
+	}
+	switch meta := args[1].(type) {
+	case TableObj:
+		table.Table.Meta = meta.Table
+	case NilValue:
+		table.Table.Meta = nil
+	default:
+		return nil, &EvalError{Message: fmt.Sprintf("setmeta: metatable must be table or nil, got %s", meta.Type())}
+	}
+	return table, nil
+}
+
+func builtinGetMeta(args []Object) (Object, *EvalError) {
+	if err := checkNArgs("getmeta", args, 1); err != nil {
+		return nil, err
+	}
+	if table, ok := args[0].(TableObj); ok && table.Table.Meta != nil {
+		return TableObj{Table: table.Table.Meta}, nil
+	}
+	return NilObj, nil
+}
+
+// error(message [, data]) 创建错误对象，通常配合 throw 使用
+func builtinError(args []Object) (Object, *EvalError) {
+	message, err := argString("error", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	data := NilObj
+	if len(args) > 1 {
+		data = args[1]
+	}
+	return ErrorObj{Err: &ErrorValue{Message: message, Data: data}}, nil
+}
+
+func toString(obj Object) (string, *EvalError) {
+	switch obj := obj.(type) {
+	case IntegerObj:
+		return fmt.Sprintf("%d", obj.Value), nil
+	case BigIntObj:
+		return obj.Value.String(), nil
+	case FloatObj:
+		return fmt.Sprintf("%g", obj.Value), nil
+	case BooleanObj:
+		return fmt.Sprintf("%t", obj.Value), nil
+	case StringObj:
+		return obj.Value, nil
+	case TimeObj:
+		return obj.Value.Format(time.RFC3339Nano), nil
+	case DurationObj:
+		return obj.Value.String(), nil
+	case NilValue:
+		return "nil", nil
+	case PackObj:
+		buf := bytes.Buffer{}
+		buf.WriteString("[")
+		for i, o := range obj.Pack.Objs {
+			if i != 0 {
+				buf.WriteString(", ")
+			}
+			s, err := toString(o)
+			if err != nil {
+				return "", err
+			}
+			buf.WriteString(s)
+		}
+		buf.WriteString("]")
+		return buf.String(), nil
+	case TableObj:
+		if h := getMetaMethod(obj, "__tostring"); h != nil {
+			res, err := callFunction(nil, h, []Object{obj})
+			if err != nil {
+				return "", err
+			}
+			if s, ok := res.(StringObj); ok {
+				return s.Value, nil
+			}
+			return "", &EvalError{Message: "__tostring must return a string"}
+		}
+		return fmt.Sprintf("table: %p", obj.Table), nil
+	case FuncObj:
+		return fmt.Sprintf("func: %p", obj.Func), nil
+	case NativeFuncObj:
+		return fmt.Sprintf("func: builtin %s", obj.Func.Name), nil
+	case ErrorObj:
+		return fmt.Sprintf("error: %s", obj.Err.Message), nil
+	case GeneratorObj:
+		return fmt.Sprintf("generator: %p", obj.Gen), nil
+	case CoroutineObj:
+		return fmt.Sprintf("coroutine: %p", obj.Co), nil
+	case TaskObj:
+		return fmt.Sprintf("task: %p", obj.Task), nil
+	case ChanObj:
+		return fmt.Sprintf("chan: %p", obj.Chan), nil
+	case WaitGroupObj:
+		return fmt.Sprintf("waitgroup: %p", obj.WaitGroup), nil
+	default:
+		return "", &EvalError{Message: fmt.Sprintf("tostring: unknown object type %s", obj.Type())}
+	}
+}
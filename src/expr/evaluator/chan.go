@@ -0,0 +1,118 @@
+package evaluator
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// chan(n) 创建容量为 n 的通道，n 省略时为无缓冲通道
+func (in *Interpreter) newChan(args []Object) (Object, *EvalError) {
+	var size int64
+	if hasArg(args, 0) {
+		n, err := argInteger("chan", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, &EvalError{Message: fmt.Sprintf("chan: negative capacity %d", n)}
+		}
+		size = n
+	}
+	return ChanObj{Chan: &ChanValue{in: in, ch: make(chan Object, size)}}, nil
+}
+
+func (c *ChanValue) send(v Object) (err *EvalError) {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return &EvalError{Message: "send on closed channel"}
+	}
+	c.in.Blocking(func() {
+		// 阻塞期间通道可能被其他任务关闭
+		defer func() {
+			if recover() != nil {
+				err = &EvalError{Message: "send on closed channel"}
+			}
+		}()
+		c.ch <- v
+	})
+	return err
+}
+
+// recv 返回收到的值，ok 为 false 表示通道已关闭且没有剩余的值
+func (c *ChanValue) recv() (v Object, ok bool) {
+	c.in.Blocking(func() { v, ok = <-c.ch })
+	if !ok {
+		return NilObj, false
+	}
+	return v, true
+}
+
+func (c *ChanValue) close() *EvalError {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return &EvalError{Message: "close of closed channel"}
+	}
+	c.closed = true
+	close(c.ch)
+	return nil
+}
+
+// 通道的字段：send(v) 发送，recv() 接收，通道关闭后返回 nil；close() 关闭通道
+func indexChanObj(c ChanObj, index Object) Object {
+	key, _ := index.(StringObj)
+	// 以方法调用时第一个参数是通道自身
+	stripSelf := func(args []Object) []Object {
+		if len(args) != 0 && args[0] == c {
+			return args[1:]
+		}
+		return args
+	}
+	switch key.Value {
+	case "send":
+		return NewNativeFunc("chan.send", func(args []Object) (Object, *EvalError) {
+			args = stripSelf(args)
+			if len(args) == 0 {
+				return nil, argMissingError("chan.send", 0, "value")
+			}
+			return NilObj, c.Chan.send(args[0])
+		})
+	case "recv":
+		return NewNativeFunc("chan.recv", func(args []Object) (Object, *EvalError) {
+			v, _ := c.Chan.recv()
+			return v, nil
+		})
+	case "close":
+		return NewNativeFunc("chan.close", func(args []Object) (Object, *EvalError) {
+			return NilObj, c.Chan.close()
+		})
+	}
+	return NilObj
+}
+
+// recv_any(c1, c2, ...) 从最先就绪的通道接收，返回 [value, i]，i 是通道的序号，从 1 开始；
+// 就绪的通道已关闭时 value 为 nil
+func (in *Interpreter) recvAny(args []Object) (Object, *EvalError) {
+	if len(args) == 0 {
+		return nil, argMissingError("recv_any", 0, "chan")
+	}
+	cases := make([]reflect.SelectCase, len(args))
+	for i, arg := range args {
+		c, ok := arg.(ChanObj)
+		if !ok {
+			return nil, argTypeError("recv_any", i, "chan", arg)
+		}
+		cases[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.Chan.ch)}
+	}
+	var chosen int
+	var v reflect.Value
+	var ok bool
+	in.Blocking(func() { chosen, v, ok = reflect.Select(cases) })
+	value := Object(NilObj)
+	if ok {
+		value = v.Interface().(Object)
+	}
+	return newPack([]Object{value, IntegerObj{Value: int64(chosen + 1)}}), nil
+}
@@ -0,0 +1,193 @@
+package evaluator
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+type coStatus int
+
+const (
+	coSuspended coStatus = iota
+	coRunning
+	coNormal // 唤醒了其他协程，正在等待其让出
+	coDead
+)
+
+func (s coStatus) String() string {
+	switch s {
+	case coSuspended:
+		return "suspended"
+	case coRunning:
+		return "running"
+	case coNormal:
+		return "normal"
+	default:
+		return "dead"
+	}
+}
+
+type coResult struct {
+	values []Object
+	err    *EvalError
+	done   bool
+}
+
+// coroutine 在单独的 goroutine 中执行 run，resume 与 yield 通过 channel 交接控制权，
+// 任意时刻只有一方在运行，因此求值过程不需要额外加锁。
+// 协程被 close 时，挂起处的 yield 返回 abortClose 错误，函数体随之展开并执行 defer；
+// 被 kill 时返回 abortKill 错误，展开时不再执行任何脚本代码
+type coroutine struct {
+	run      func(co *coroutine, args []Object) (Object, *EvalError)
+	resumeCh chan []Object
+	yieldCh  chan coResult // 容量为 1，协程结束时的发送不会阻塞
+	status   coStatus
+	started  bool
+	owner    *coRegistry // 启动后登记在所属解释器中，为 nil 时只依赖 finalizer 回收
+
+	closeOnce sync.Once
+	killed    atomic.Bool
+}
+
+func newCoroutine(owner *coRegistry, run func(co *coroutine, args []Object) (Object, *EvalError)) *coroutine {
+	return &coroutine{
+		run:      run,
+		resumeCh: make(chan []Object),
+		yieldCh:  make(chan coResult, 1),
+		status:   coSuspended,
+		owner:    owner,
+	}
+}
+
+func (co *coroutine) main(args []Object) {
+	var obj Object
+	var err *EvalError
+	// 协程内的 panic 无法被宿主 recover，转换为错误交给 resume 的一方
+	defer func() {
+		if r := recover(); r != nil {
+			obj, err = NilObj, &EvalError{Message: fmt.Sprintf("coroutine panic: %v", r)}
+		}
+		co.yieldCh <- coResult{values: []Object{obj}, err: err, done: true}
+	}()
+	obj, err = co.run(co, args)
+	if err != nil && err.abort != abortNone {
+		obj, err = NilObj, nil
+	}
+}
+
+// resume 把控制权交给协程，直到协程 yield 或结束
+func (co *coroutine) resume(args []Object) ([]Object, bool, *EvalError) {
+	switch co.status {
+	case coDead:
+		return nil, true, &EvalError{Message: "cannot resume dead coroutine"}
+	case coRunning, coNormal:
+		return nil, false, &EvalError{Message: "cannot resume non-suspended coroutine"}
+	}
+	co.status = coRunning
+	if !co.started {
+		co.started = true
+		co.owner.add(co)
+		go co.main(args)
+	} else {
+		co.resumeCh <- args
+	}
+	r := <-co.yieldCh
+	if r.done {
+		co.status = coDead
+		co.owner.remove(co)
+	} else {
+		co.status = coSuspended
+	}
+	return r.values, r.done, r.err
+}
+
+// yield 在协程内部调用，把 values 交给 resume 的一方并等待下一次 resume
+func (co *coroutine) yield(values []Object) ([]Object, *EvalError) {
+	co.yieldCh <- coResult{values: values}
+	args, ok := <-co.resumeCh
+	if !ok {
+		if co.killed.Load() {
+			return nil, &EvalError{Message: "coroutine killed", abort: abortKill}
+		}
+		return nil, &EvalError{Message: "coroutine closed", abort: abortClose}
+	}
+	return args, nil
+}
+
+// close 结束挂起的协程并等待其展开完成，返回 defer 中产生的错误
+func (co *coroutine) close() *EvalError {
+	switch co.status {
+	case coDead:
+		return nil
+	case coRunning, coNormal:
+		return &EvalError{Message: "cannot close running coroutine"}
+	}
+	if !co.started {
+		co.status = coDead
+		return nil
+	}
+	co.status = coRunning
+	co.closeOnce.Do(func() { close(co.resumeCh) })
+	for {
+		r := <-co.yieldCh
+		if r.done {
+			co.status = coDead
+			co.owner.remove(co)
+			return r.err
+		}
+	}
+}
+
+// kill 用于协程对象被回收或解释器 Close 时，只让挂起的 goroutine 退出，不等待也不执行脚本代码
+func (co *coroutine) kill() {
+	co.killed.Store(true)
+	co.closeOnce.Do(func() { close(co.resumeCh) })
+	co.owner.remove(co)
+}
+
+// coRegistry 记录解释器中已经启动、尚未结束的协程。
+// 挂起的 goroutine 引用着协程函数的环境，环境中又引用协程对象时（如 h.g = g），
+// 协程对象始终可达，finalizer 不会执行，这样的协程由解释器的 Close 结束
+type coRegistry struct {
+	mu   sync.Mutex
+	live map[*coroutine]struct{}
+}
+
+func (r *coRegistry) add(co *coroutine) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.live == nil {
+		r.live = make(map[*coroutine]struct{})
+	}
+	r.live[co] = struct{}{}
+}
+
+func (r *coRegistry) remove(co *coroutine) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.live, co)
+}
+
+// killAll 结束所有挂起的协程，调用方需要持有解释器的 gil。
+// 正在运行或处于 normal 状态的协程属于阻塞中的任务，不受影响
+func (r *coRegistry) killAll() {
+	r.mu.Lock()
+	suspended := make([]*coroutine, 0, len(r.live))
+	for co := range r.live {
+		if co.status == coSuspended {
+			suspended = append(suspended, co)
+		}
+	}
+	r.mu.Unlock()
+	for _, co := range suspended {
+		co.status = coDead
+		co.kill()
+	}
+}
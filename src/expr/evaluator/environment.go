@@ -1,8 +1,31 @@
 package evaluator
 
+import "expr/parser"
+
 type Environment struct {
 	LocalVars map[string]*Object
 	Outer     *Environment
+
+	interp *Interpreter // 所属解释器，内层环境继承，Close 后仍保留
+	frame  *callFrame   // 所在的函数调用，内层环境继承
+	frozen bool
+}
+
+// 一次函数调用中登记的 defer 表达式，生成器的调用还记录其所在的协程
+type callFrame struct {
+	defers    []deferredExpr
+	co        *coroutine
+	protected int // 正在执行的 try 和 for in 的层数，其中的 return 不是尾调用
+}
+
+// 没有 defer、不在 try 和 for in 中、不在生成器中的 return f(x) 是尾调用
+func (f *callFrame) canTailCall() bool {
+	return f != nil && f.co == nil && f.protected == 0 && len(f.defers) == 0
+}
+
+type deferredExpr struct {
+	expr parser.Expression
+	env  *Environment
 }
 
 func NewEnv() *Environment {
@@ -16,23 +39,58 @@ func NewInnerEnv(outer *Environment) *Environment {
 	return &Environment{
 		LocalVars: make(map[string]*Object),
 		Outer:     outer,
+		interp:    outer.interp,
+		frame:     outer.frame,
 	}
 }
 
 func (e *Environment) Get(varName string) *Object {
+	obj, _ := e.lookup(varName)
+	return obj
+}
+
+// 返回变量及其所在的环境
+func (e *Environment) lookup(varName string) (*Object, *Environment) {
 	searchEnv := e
 	for searchEnv != nil {
 		obj := searchEnv.LocalVars[varName]
 		if obj != nil {
-			return obj
+			return obj, searchEnv
 		}
 		searchEnv = searchEnv.Outer
 	}
+	return nil, nil
+}
+
+// getForWrite 返回可以写入的变量。变量在冻结的环境中时，
+// 复制到冻结环境之前最近的一层环境中（写时复制），冻结的环境本身不会被修改
+func (e *Environment) getForWrite(varName string) *Object {
+	var owner *Environment
+	for searchEnv := e; searchEnv != nil; searchEnv = searchEnv.Outer {
+		obj := searchEnv.LocalVars[varName]
+		if obj != nil && !searchEnv.frozen {
+			return obj
+		}
+		if obj != nil {
+			if owner == nil {
+				return nil
+			}
+			copied := *obj
+			owner.LocalVars[varName] = &copied
+			return &copied
+		}
+		if !searchEnv.frozen {
+			owner = searchEnv
+		}
+	}
 	return nil
 }
 
 // 可共享底层obj
 func (e *Environment) Set(varName string, object *Object) {
+	if e.frozen {
+		panic("Environment.Set on frozen environment")
+	}
 	e.LocalVars[varName] = object
 }
 
@@ -43,3 +101,40 @@ func (e *Environment) SetNewObj(varName string, object Object) {
 func (e *Environment) Close() {
 	e.Outer = nil
 }
+
+// Freeze 把环境及其外层冻结为只读，变量引用的表、函数捕获的环境一并冻结。
+// 冻结的环境可以作为多个 goroutine 中内层环境的共同外层，读取时不需要加锁：
+// 内层的声明写入内层环境，对冻结变量的赋值写时复制到内层，对冻结的表赋值报错
+func (e *Environment) Freeze() {
+	for env := e; env != nil && !env.frozen; env = env.Outer {
+		env.frozen = true
+		for _, obj := range env.LocalVars {
+			freezeObj(*obj)
+		}
+	}
+}
+
+func freezeObj(obj Object) {
+	switch obj := obj.(type) {
+	case TableObj:
+		freezeTable(obj.Table)
+	case PackObj:
+		for _, o := range obj.Pack.Objs {
+			freezeObj(o)
+		}
+	case FuncObj:
+		obj.Func.FuncEnv.Freeze()
+	}
+}
+
+func freezeTable(table *TableValue) {
+	if table == nil || table.frozen {
+		return
+	}
+	table.frozen = true
+	for k, v := range table.Store {
+		freezeObj(k)
+		freezeObj(v)
+	}
+	freezeTable(table.Meta)
+}
@@ -6,8 +6,72 @@ import (
 
 type EvalError struct {
 	Message string
+
+	Value     *ErrorValue // throw 抛出的错误，运行时错误为 nil
+	Traceback []string    // 错误经过的函数调用，最内层在前
+
+	abort abortKind // 协程被关闭时用于展开调用栈，不能被 catch 捕获
 }
 
+type abortKind int
+
+const (
+	abortNone  abortKind = iota
+	abortClose           // 展开时执行 defer
+	abortKill            // 展开时不执行任何脚本代码
+)
+
 func (t EvalError) Error() string {
 	return fmt.Sprintf("EvalError: %s", t.Message)
 }
+
+// 把 EvalError 转换为脚本中可见的 ErrorObj
+func (t *EvalError) toErrorObj() ErrorObj {
+	if t.Value != nil {
+		t.Value.Traceback = t.Traceback
+		return ErrorObj{Err: t.Value}
+	}
+	return ErrorObj{Err: &ErrorValue{Message: t.Message, Data: NilObj, Traceback: t.Traceback}}
+}
+
+// 抛出 value，value 为 ErrorObj 时保留原来的调用栈
+func throwError(value Object) *EvalError {
+	if e, ok := value.(ErrorObj); ok {
+		return &EvalError{
+			Message:   e.Err.Message,
+			Value:     e.Err,
+			Traceback: append([]string(nil), e.Err.Traceback...),
+		}
+	}
+	ev := newErrorValue(value)
+	return &EvalError{Message: ev.Message, Value: ev}
+}
+
+// 表的 message 字段为字符串时作为错误信息，否则使用 tostring 的结果
+func newErrorValue(data Object) *ErrorValue {
+	message := ""
+	if table, ok := data.(TableObj); ok {
+		if m, ok := table.Table.Store[StringObj{Value: "message"}].(StringObj); ok {
+			message = m.Value
+		}
+	}
+	if message == "" {
+		s, err := toString(data)
+		if err != nil {
+			s = err.Message
+		}
+		message = s
+	}
+	return &ErrorValue{Message: message, Data: data}
+}
+
+func funcFrameName(fn Object) string {
+	switch fn := fn.(type) {
+	case FuncObj:
+		return fmt.Sprintf("func at line %d", fn.Func.Body.Token.Line)
+	case NativeFuncObj:
+		return fmt.Sprintf("builtin %s", fn.Func.Name)
+	default:
+		return fmt.Sprintf("%s __call", fn.Type())
+	}
+}
@@ -1,9 +1,12 @@
 package evaluator
 
 import (
+	"bytes"
 	"expr/lexer"
 	"expr/parser"
 	"fmt"
+	"math"
+	"math/big"
 )
 
 func Eval(e parser.Expression, env *Environment) (Object, *EvalError) {
@@ -11,12 +14,16 @@ func Eval(e parser.Expression, env *Environment) (Object, *EvalError) {
 	//基本
 	case *parser.IntegerExpr:
 		return IntegerObj{Value: e.Value}, nil
+	case *parser.BigIntegerExpr:
+		return normalizeBigInt(e.Value), nil
 	case *parser.FloatExpr:
 		return FloatObj{Value: e.Value}, nil
 	case *parser.BooleanExpr:
 		return BooleanObj{Value: e.Value}, nil
 	case *parser.StringExpr:
 		return StringObj{Value: e.Value}, nil
+	case *parser.InterpolatedStringExpr:
+		return evalInterpolatedStringExpr(e, env)
 	case *parser.NilExpr:
 		return NilObj, nil
 	case *parser.TableExpr:
@@ -38,25 +45,51 @@ func Eval(e parser.Expression, env *Environment) (Object, *EvalError) {
 		return evalIndexExpr(e, env)
 	case *parser.IfExpr:
 		return evalIfExpr(e, env)
+	case *parser.TryExpr:
+		return evalTryExpr(e, env)
+	case *parser.ForExpr:
+		return evalForExpr(e, env)
+	case *parser.ForInExpr:
+		return evalForInExpr(e, env)
 	case *parser.FuncExpr:
 		return evalFuncExpr(e, env)
 	case *parser.CallExpr:
 		return evalCallExpr(e, env)
+	case *parser.MethodCallExpr:
+		return evalMethodCallExpr(e, env)
+	case *parser.ImportExpr:
+		return evalImportExpr(e, env)
 
 	//变量
 	case *parser.DeclarationExpr:
 		return evalDeclarationExpr(e, env)
 	case *parser.AssignExpr:
 		return evalAssignExpr(e, env)
+	case *parser.CompoundAssignExpr:
+		return evalCompoundAssignExpr(e, env)
+	case *parser.IncDecExpr:
+		return evalIncDecExpr(e, env)
 	case *parser.Identifier:
 		return evalIdentifierExpr(e, env)
 
 	//包装
 	case *parser.ReturnExpr:
+		if env.frame.canTailCall() {
+			if fn, args, ok, err := evalTailCall(e.ReturnValue, env); ok || err != nil {
+				if err != nil {
+					return nil, err
+				}
+				return ReturnObj{Value: tailCallObj{in: env.interp, fn: fn, args: args}}, nil
+			}
+		}
 		obj, err := Eval(e.ReturnValue, env)
 		if err != nil {
 			return nil, err
 		}
+		// 返回值表达式中已经 return 时不再包装
+		if ret, ok := obj.(ReturnObj); ok {
+			return ret, nil
+		}
 		return ReturnObj{Value: obj}, nil
 	case *parser.BreakExpr:
 		obj, err := Eval(e.BreakValue, env)
@@ -64,10 +97,42 @@ func Eval(e parser.Expression, env *Environment) (Object, *EvalError) {
 			return nil, err
 		}
 		return BreakObj{Value: obj}, nil
+	case *parser.SpreadExpr:
+		return nil, &EvalError{Message: "spread outside of call arguments"}
+	case *parser.DeferExpr:
+		if env.frame == nil {
+			return nil, &EvalError{Message: "defer outside of function"}
+		}
+		env.frame.defers = append(env.frame.defers, deferredExpr{expr: e.Value, env: env})
+		return NilObj, nil
+	case *parser.YieldExpr:
+		return evalYieldExpr(e, env)
+	case *parser.ThrowExpr:
+		obj, err := Eval(e.Value, env)
+		if err != nil {
+			return nil, err
+		}
+		return nil, throwError(obj)
 	}
 	panic(fmt.Sprintf("Eval unhand expression: %s", e.String(0)))
 }
 
+func evalInterpolatedStringExpr(expr *parser.InterpolatedStringExpr, env *Environment) (Object, *EvalError) {
+	buf := bytes.Buffer{}
+	for _, part := range expr.Parts {
+		obj, err := Eval(part, env)
+		if err != nil {
+			return nil, err
+		}
+		s, err := toString(obj)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString(s)
+	}
+	return StringObj{Value: buf.String()}, nil
+}
+
 func evalTableExpr(expr *parser.TableExpr, env *Environment) (Object, *EvalError) {
 	table := &TableValue{Store: make(map[Object]Object)}
 	for _, pair := range expr.InitValue {
@@ -75,11 +140,14 @@ func evalTableExpr(expr *parser.TableExpr, env *Environment) (Object, *EvalError
 		if err != nil {
 			return nil, err
 		}
+		if err := checkTableKey(key); err != nil {
+			return nil, err
+		}
 		value, err := Eval(pair.Value, env)
 		if err != nil {
 			return nil, err
 		}
-		table.Store[key] = value
+		table.set(key, value)
 	}
 	return TableObj{Table: table}, nil
 }
@@ -113,6 +181,8 @@ func toFloatObj(obj Object) FloatObj {
 		return obj
 	case IntegerObj:
 		return FloatObj{Value: float64(obj.Value)}
+	case BigIntObj:
+		return FloatObj{Value: bigIntToFloat(obj.Value)}
 	default:
 		panic("toFloatObj with wrong parameter")
 	}
@@ -123,13 +193,18 @@ func evalArithPrefixExpr(expr *parser.ArithPrefixExpr, env *Environment) (Object
 	if err != nil {
 		return nil, err
 	}
+	if obj, ok, err := metaArithPrefix(env.interp, expr.Op, right); ok || err != nil {
+		return obj, err
+	}
 	if expr.Op == lexer.T_BANG {
 		right := toBooleanObj(right)
 		return BooleanObj{Value: !right.Value}, nil
 	} else if expr.Op == lexer.T_MINUS {
 		switch right := right.(type) {
 		case IntegerObj:
-			return IntegerObj{Value: -right.Value}, nil
+			return checkedNeg(right.Value), nil
+		case BigIntObj:
+			return normalizeBigInt(new(big.Int).Neg(right.Value)), nil
 		case FloatObj:
 			return FloatObj{Value: -right.Value}, nil
 		default:
@@ -137,6 +212,16 @@ func evalArithPrefixExpr(expr *parser.ArithPrefixExpr, env *Environment) (Object
 				Message: fmt.Sprintf("minus prefix operator with wrong value type %s", right.Type().String()),
 			}
 		}
+	} else if expr.Op == lexer.T_TILDE {
+		switch right := right.(type) {
+		case IntegerObj:
+			return IntegerObj{Value: ^right.Value}, nil
+		case BigIntObj:
+			return normalizeBigInt(new(big.Int).Not(right.Value)), nil
+		}
+		return nil, &EvalError{
+			Message: fmt.Sprintf("bitwise operator ~ requires integer operand, got %s", right.Type().String()),
+		}
 	} else {
 		return nil, &EvalError{Message: "unknown Arith Prefix operator"}
 	}
@@ -151,7 +236,11 @@ func evalArithInfixExpr(expr *parser.ArithInfixExpr, env *Environment) (Object,
 	if err != nil {
 		return nil, err
 	}
-	switch expr.Op {
+	return evalInfixOperator(env.interp, expr.Op, left, right)
+}
+
+func evalInfixOperator(in *Interpreter, op lexer.TokenType, left Object, right Object) (Object, *EvalError) {
+	switch op {
 	case lexer.T_AND:
 		if toBooleanObj(left).Value {
 			return right, nil
@@ -164,30 +253,59 @@ func evalArithInfixExpr(expr *parser.ArithInfixExpr, env *Environment) (Object,
 		} else {
 			return right, nil
 		}
+	case lexer.T_PERCENT, lexer.T_POWER, lexer.T_DOUBLE_SLASH:
+		if obj, ok, err := metaArithInfix(in, op, left, right); ok || err != nil {
+			return obj, err
+		}
+		return evalNumberInfix(op, left, right)
+	case lexer.T_AMPERSAND, lexer.T_PIPE, lexer.T_CARET, lexer.T_SHL, lexer.T_SHR:
+		if obj, ok, err := metaArithInfix(in, op, left, right); ok || err != nil {
+			return obj, err
+		}
+		return evalBitwiseInfix(op, left, right)
 	case lexer.T_PLUS, lexer.T_MINUS, lexer.T_ASTERISK, lexer.T_SLASH,
 		lexer.T_LT, lexer.T_LE, lexer.T_GT, lexer.T_GE, lexer.T_EQ, lexer.T_NEQ:
+		if obj, ok, err := metaArithInfix(in, op, left, right); ok || err != nil {
+			return obj, err
+		}
+		if left.Type() == TBigIntObj || right.Type() == TBigIntObj {
+			if obj, ok, err := evalBigIntInfix(op, left, right); ok {
+				return obj, err
+			}
+		}
+		if isTimeObj(left) || isTimeObj(right) {
+			if obj, ok, err := evalTimeInfix(op, left, right); ok {
+				return obj, err
+			}
+		}
 		if left.Type() == right.Type() {
-			switch expr.Op {
+			switch op {
 			case lexer.T_PLUS:
 				if left.Type() == TIntegerObj {
-					return IntegerObj{Value: left.(IntegerObj).Value + right.(IntegerObj).Value}, nil
+					return checkedAdd(left.(IntegerObj).Value, right.(IntegerObj).Value), nil
 				} else if left.Type() == TFloatObj {
 					return FloatObj{Value: left.(FloatObj).Value + right.(FloatObj).Value}, nil
 				}
 			case lexer.T_MINUS:
 				if left.Type() == TIntegerObj {
-					return IntegerObj{Value: left.(IntegerObj).Value - right.(IntegerObj).Value}, nil
+					return checkedSub(left.(IntegerObj).Value, right.(IntegerObj).Value), nil
 				} else if left.Type() == TFloatObj {
 					return FloatObj{Value: left.(FloatObj).Value - right.(FloatObj).Value}, nil
 				}
 			case lexer.T_ASTERISK:
 				if left.Type() == TIntegerObj {
-					return IntegerObj{Value: left.(IntegerObj).Value * right.(IntegerObj).Value}, nil
+					return checkedMul(left.(IntegerObj).Value, right.(IntegerObj).Value), nil
 				} else if left.Type() == TFloatObj {
 					return FloatObj{Value: left.(FloatObj).Value * right.(FloatObj).Value}, nil
 				}
 			case lexer.T_SLASH:
 				if left.Type() == TIntegerObj {
+					if right.(IntegerObj).Value == 0 {
+						return nil, &EvalError{Message: "integer divide by zero"}
+					}
+					if left.(IntegerObj).Value == math.MinInt64 && right.(IntegerObj).Value == -1 {
+						return checkedNeg(math.MinInt64), nil
+					}
 					return IntegerObj{Value: left.(IntegerObj).Value / right.(IntegerObj).Value}, nil
 				} else if left.Type() == TFloatObj {
 					return FloatObj{Value: left.(FloatObj).Value / right.(FloatObj).Value}, nil
@@ -253,7 +371,7 @@ func evalArithInfixExpr(expr *parser.ArithInfixExpr, env *Environment) (Object,
 			}
 		} else if (left.Type() == TIntegerObj || left.Type() == TFloatObj) &&
 			(right.Type() == TIntegerObj || right.Type() == TFloatObj) {
-			switch expr.Op {
+			switch op {
 			case lexer.T_PLUS:
 				return FloatObj{Value: toFloatObj(left).Value + toFloatObj(right).Value}, nil
 			case lexer.T_MINUS:
@@ -277,11 +395,24 @@ func evalArithInfixExpr(expr *parser.ArithInfixExpr, env *Environment) (Object,
 			}
 		}
 	}
-	return nil, &EvalError{Message: fmt.Sprintf("Arith Infix Expr operator and operand: %s", expr.String(0))}
+	return nil, &EvalError{Message: fmt.Sprintf("Arith Infix Expr operator and operand: %s %s %s",
+		left.Type(), operatorString(op), right.Type())}
 }
 
 func evalFuncBlockExpr(block *parser.BlockExpr, env *Environment) (Object, *EvalError) {
+	obj, err := evalFrameBlockExpr(block, env, &callFrame{})
+	if tc, ok := obj.(tailCallObj); ok && err == nil {
+		return callFunction(tc.in, tc.fn, tc.args)
+	}
+	return obj, err
+}
+
+func evalFrameBlockExpr(block *parser.BlockExpr, env *Environment, frame *callFrame) (Object, *EvalError) {
+	env.frame = frame
 	obj, err := evalBlockExpr(block, env)
+	if len(frame.defers) != 0 {
+		obj, err = runDefers(frame, obj, err)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -293,6 +424,27 @@ func evalFuncBlockExpr(block *parser.BlockExpr, env *Environment) (Object, *Eval
 	}
 }
 
+// 按后进先出的顺序执行 defer 表达式，直到没有剩余的 defer，defer 中注册的 defer 也会执行
+// defer 中的错误会替换原来的错误，原来的错误信息和调用栈接在新错误的 traceback 后面
+func runDefers(frame *callFrame, obj Object, err *EvalError) (Object, *EvalError) {
+	if err != nil && err.abort == abortKill {
+		return obj, err
+	}
+	for len(frame.defers) != 0 {
+		d := frame.defers[len(frame.defers)-1]
+		frame.defers = frame.defers[:len(frame.defers)-1]
+		if _, deferErr := Eval(d.expr, d.env); deferErr != nil {
+			if err != nil {
+				deferErr.Traceback = append(deferErr.Traceback, fmt.Sprintf("while handling error: %s", err.Message))
+				deferErr.Traceback = append(deferErr.Traceback, err.Traceback...)
+			}
+			obj, err = nil, deferErr
+		}
+	}
+	frame.defers = nil
+	return obj, err
+}
+
 func evalBlockExpr(block *parser.BlockExpr, env *Environment) (Object, *EvalError) {
 	for _, expr := range block.Exprs {
 		obj, err := Eval(expr, env)
@@ -314,19 +466,16 @@ func evalIndexExpr(expr *parser.IndexExpr, env *Environment) (Object, *EvalError
 	if err != nil {
 		return nil, err
 	}
-	if table, ok := table.(TableObj); ok {
-		index, err := Eval(expr.Index, env)
-		if err != nil {
-			return nil, err
-		}
-		if res, ok := table.Table.Store[index]; ok {
-			return res, nil
-		} else {
-			return NilObj, nil
-		}
-	} else {
+	switch table.Type() {
+	case TTableObj, TErrorObj, TGeneratorObj, TTaskObj, TChanObj, TWaitGroupObj:
+	default:
 		return nil, &EvalError{Message: "eval an index of non table"}
 	}
+	index, err := Eval(expr.Index, env)
+	if err != nil {
+		return nil, err
+	}
+	return indexObj(env.interp, table, index)
 }
 
 func evalIfExpr(expr *parser.IfExpr, env *Environment) (Object, *EvalError) {
@@ -344,6 +493,130 @@ func evalIfExpr(expr *parser.IfExpr, env *Environment) (Object, *EvalError) {
 	}
 }
 
+func evalYieldExpr(expr *parser.YieldExpr, env *Environment) (Object, *EvalError) {
+	if env.frame == nil || env.frame.co == nil {
+		return nil, &EvalError{Message: "yield outside generator"}
+	}
+	value := NilObj
+	if expr.Value != nil {
+		obj, err := Eval(expr.Value, env)
+		if err != nil {
+			return nil, err
+		}
+		value = obj
+	}
+	args, err := env.frame.co.yield([]Object{value})
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return NilObj, nil
+	}
+	return args[0], nil
+}
+
+// 执行一次循环体，stop 为 true 时结束循环，obj 为 ReturnObj 或 break 的值
+func evalLoopBody(body *parser.BlockExpr, env *Environment) (obj Object, stop bool, err *EvalError) {
+	for _, expr := range body.Exprs {
+		obj, err := Eval(expr, env)
+		if err != nil {
+			return nil, true, err
+		}
+		switch obj := obj.(type) {
+		case ReturnObj:
+			return obj, true, nil
+		case BreakObj:
+			return obj.Value, true, nil
+		}
+	}
+	return NilObj, false, nil
+}
+
+func evalForExpr(expr *parser.ForExpr, env *Environment) (Object, *EvalError) {
+	forEnv := NewInnerEnv(env)
+	if _, err := Eval(expr.InitExpr, forEnv); err != nil {
+		return nil, err
+	}
+	for {
+		condition, err := Eval(expr.EdgeExpr, forEnv)
+		if err != nil {
+			return nil, err
+		}
+		if !toBooleanObj(condition).Value {
+			return NilObj, nil
+		}
+		obj, stop, err := evalLoopBody(expr.Body, NewInnerEnv(forEnv))
+		if stop {
+			return obj, err
+		}
+		if _, err := Eval(expr.StepExpr, forEnv); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// 循环提前结束或出错时关闭迭代器
+func evalForInExpr(expr *parser.ForInExpr, env *Environment) (Object, *EvalError) {
+	iterable, err := Eval(expr.Iterable, env)
+	if err != nil {
+		return nil, err
+	}
+	it, err := newIterator(env.interp, iterable)
+	if err != nil {
+		return nil, err
+	}
+	// 循环提前结束时需要关闭迭代器，循环体中的 return 不能作为尾调用
+	if env.frame != nil {
+		env.frame.protected++
+		defer func() { env.frame.protected-- }()
+	}
+	for {
+		values, ok, err := it.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return NilObj, nil
+		}
+		loopEnv := NewInnerEnv(env)
+		for i, v := range expr.Vars {
+			if i < len(values) {
+				loopEnv.SetNewObj(v.Ident, values[i])
+			} else {
+				loopEnv.SetNewObj(v.Ident, NilObj)
+			}
+		}
+		obj, stop, err := evalLoopBody(expr.Body, loopEnv)
+		if stop {
+			if err == nil || err.abort == abortNone {
+				if closeErr := it.close(); closeErr != nil && err == nil {
+					return nil, closeErr
+				}
+			}
+			return obj, err
+		}
+	}
+}
+
+func evalTryExpr(expr *parser.TryExpr, env *Environment) (Object, *EvalError) {
+	obj, err := evalTryBody(expr.Body, env)
+	if err == nil || err.abort != abortNone {
+		return obj, err
+	}
+	catchEnv := NewInnerEnv(env)
+	catchEnv.SetNewObj(expr.CatchVar.Ident, err.toErrorObj())
+	return evalBlockExpr(expr.Catch, catchEnv)
+}
+
+// try 中的 return 不能作为尾调用，否则被调用函数中的错误不会被捕获
+func evalTryBody(body parser.Expression, env *Environment) (Object, *EvalError) {
+	if env.frame != nil {
+		env.frame.protected++
+		defer func() { env.frame.protected-- }()
+	}
+	return Eval(body, env)
+}
+
 func evalFuncExpr(expr *parser.FuncExpr, env *Environment) (Object, *EvalError) {
 	funcCaptureEnv := NewInnerEnv(env)
 	for _, capture := range expr.Capture {
@@ -354,10 +627,15 @@ func evalFuncExpr(expr *parser.FuncExpr, env *Environment) (Object, *EvalError)
 				return nil, err
 			}
 		case *parser.Identifier:
-			outerObj := env.Get(capture.Ident)
+			outerObj, outerEnv := env.lookup(capture.Ident)
 			if outerObj == nil {
 				return nil, &EvalError{Message: "FuncExpr capture a wrong identifier"}
 			}
+			if outerEnv.frozen {
+				// 冻结的变量按值捕获，函数中的赋值不影响共享的环境
+				copied := *outerObj
+				outerObj = &copied
+			}
 			funcCaptureEnv.LocalVars[capture.Ident] = outerObj
 		default:
 			panic("evalFuncExpr unhand capture expr type")
@@ -365,42 +643,284 @@ func evalFuncExpr(expr *parser.FuncExpr, env *Environment) (Object, *EvalError)
 	}
 	funcCaptureEnv.Close()
 	return FuncObj{Func: &FuncValue{
-		FuncEnv:    funcCaptureEnv,
-		Parameters: expr.Parameters,
-		Body:       expr.Body,
+		FuncEnv:     funcCaptureEnv,
+		Parameters:  expr.Parameters,
+		Body:        expr.Body,
+		IsGenerator: expr.IsGenerator,
 	}}, nil
 }
 
 func evalCallExpr(expr *parser.CallExpr, env *Environment) (Object, *EvalError) {
+	fn, args, err := evalCallTarget(expr, env)
+	if err != nil {
+		return nil, err
+	}
+	return callFunction(env.interp, fn, args)
+}
+
+// 求值被调用的函数和参数
+func evalCallTarget(expr *parser.CallExpr, env *Environment) (Object, []Object, *EvalError) {
 	fn, err := Eval(expr.Function, env)
 	if err != nil {
+		return nil, nil, err
+	}
+	if !isCallable(fn) {
+		return nil, nil, &EvalError{Message: fmt.Sprintf("call to a non function object %s", fn.Type())}
+	}
+	args, err := evalArgs(expr.Parameters, env, make([]Object, 0, len(expr.Parameters)))
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(expr.NamedArgs) != 0 {
+		if args, err = evalNamedArgs(fn, expr.NamedArgs, env, args, 0); err != nil {
+			return nil, nil, err
+		}
+	}
+	return fn, args, nil
+}
+
+// 求值调用参数并追加到 args，...pack 展开为多个参数
+func evalArgs(params []parser.Expression, env *Environment, args []Object) ([]Object, *EvalError) {
+	for _, param := range params {
+		if spread, ok := param.(*parser.SpreadExpr); ok {
+			obj, err := Eval(spread.Value, env)
+			if err != nil {
+				return nil, err
+			}
+			pack, ok := obj.(PackObj)
+			if !ok {
+				return nil, &EvalError{Message: fmt.Sprintf("spread of non pack object %s", obj.Type())}
+			}
+			args = append(args, pack.Pack.Objs...)
+			continue
+		}
+		obj, err := Eval(param, env)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, obj)
+	}
+	return args, nil
+}
+
+// return 的值是函数调用或方法调用时只求值函数和参数，ok 为 false 表示不是调用
+func evalTailCall(expr parser.Expression, env *Environment) (Object, []Object, bool, *EvalError) {
+	switch expr := expr.(type) {
+	case *parser.CallExpr:
+		fn, args, err := evalCallTarget(expr, env)
+		return fn, args, true, err
+	case *parser.MethodCallExpr:
+		method, args, err := evalMethodCallTarget(expr, env)
+		return method, args, true, err
+	}
+	return nil, nil, false, nil
+}
+
+// CallFunction 供原生函数回调脚本函数、原生函数或带 __call 元方法的表。
+// 宿主在 Run 之外调用时不持有 gil，应当使用 Interpreter.Call。
+// 调用方未知，共享环境中冻结的脚本函数只能使用捕获的变量和共享的全局变量
+func CallFunction(fn Object, args ...Object) (Object, *EvalError) {
+	return callFunction(nil, fn, args)
+}
+
+// in 是调用方所在的解释器，冻结的脚本函数从中查找全局变量和模块，未知时为 nil
+func callFunction(in *Interpreter, fn Object, args []Object) (Object, *EvalError) {
+	obj, err := callFunctionHelper(in, fn, args)
+	if err != nil {
+		err.Traceback = append(err.Traceback, funcFrameName(fn))
+	}
+	return obj, err
+}
+
+func callFunctionHelper(in *Interpreter, fn Object, args []Object) (Object, *EvalError) {
+	switch fn := fn.(type) {
+	case FuncObj:
+		// 尾调用在这里循环执行，不增加 Go 栈的深度。出错时 traceback 记录出错的函数和最外层的调用，
+		// 中间已经被尾调用替换的函数不出现在 traceback 中
+		obj, err := callFuncObj(in, fn, args)
+		for err == nil {
+			tc, ok := obj.(tailCallObj)
+			if !ok {
+				return obj, nil
+			}
+			next, ok := tc.fn.(FuncObj)
+			if !ok || next.Func.IsGenerator {
+				return callFunction(tc.in, tc.fn, tc.args)
+			}
+			if obj, err = callFuncObj(tc.in, next, tc.args); err != nil {
+				err.Traceback = append(err.Traceback, funcFrameName(next))
+			}
+		}
 		return nil, err
+	case NativeFuncObj:
+		return fn.Func.Fn(args)
+	case TableObj:
+		if h := getMetaMethod(fn, "__call"); h != nil {
+			return callFunctionHelper(in, h, append([]Object{fn}, args...))
+		}
 	}
-	if fnObj, ok := fn.(FuncObj); !ok {
-		return nil, &EvalError{Message: fmt.Sprintf("call to a non function object %s", fn.Type())}
-	} else {
-		funcCallEnv := NewInnerEnv(fnObj.Func.FuncEnv)
-		needNParam := len(fnObj.Func.Parameters)
-		giveNParam := len(expr.Parameters)
-		for i := 0; ; i++ {
-			var err *EvalError
-			if i < needNParam && i < giveNParam {
-				var obj Object
-				obj, err = Eval(expr.Parameters[i], env)
-				funcCallEnv.LocalVars[fnObj.Func.Parameters[i].Ident] = &obj
-			} else if i < needNParam && i >= giveNParam {
-				funcCallEnv.LocalVars[fnObj.Func.Parameters[i].Ident] = &NilObj
-			} else if i >= needNParam && i < giveNParam {
-				_, err = Eval(expr.Parameters[i], env)
-			} else {
-				break
+	return nil, &EvalError{Message: fmt.Sprintf("call to a non function object %s", fn.Type())}
+}
+
+// 调用脚本函数，返回值可能是 tailCallObj。冻结的函数可能被多个解释器共享，
+// 不使用定义时所在的解释器，而是从调用方的解释器查找全局变量和模块
+func callFuncObj(in *Interpreter, fn FuncObj, args []Object) (Object, *EvalError) {
+	funcCallEnv := NewInnerEnv(fn.Func.FuncEnv)
+	if fn.Func.FuncEnv.frozen {
+		funcCallEnv.interp = in
+	}
+	if err := bindParameters(fn, funcCallEnv, args); err != nil {
+		return nil, err
+	}
+	if fn.Func.IsGenerator {
+		body := fn.Func.Body
+		var owner *coRegistry
+		if in := funcCallEnv.interp; in != nil {
+			owner = &in.coroutines
+		}
+		return newGenerator(owner, func(co *coroutine) (Object, *EvalError) {
+			return evalFrameBlockExpr(body, funcCallEnv, &callFrame{co: co})
+		}), nil
+	}
+	return evalFrameBlockExpr(fn.Func.Body, funcCallEnv, &callFrame{})
+}
+
+// 求值按名字传递的参数。脚本函数的参数按名字放到对应的位置，跳过的位置填入 missingArg；
+// 原生函数在参数末尾收到一个以名字为键的表。offset 是参数列表之前的隐含参数个数，
+// 如 __call 的第一个参数
+func evalNamedArgs(fn Object, namedArgs []*parser.NamedArg, env *Environment, args []Object, offset int) ([]Object, *EvalError) {
+	if table, ok := fn.(TableObj); ok {
+		if h := getMetaMethod(table, "__call"); h != nil {
+			return evalNamedArgs(h, namedArgs, env, args, offset+1)
+		}
+	}
+	fnObj, isFunc := fn.(FuncObj)
+	named := newTable()
+	for _, arg := range namedArgs {
+		value, err := Eval(arg.Value, env)
+		if err != nil {
+			return nil, err
+		}
+		name := StringObj{Value: arg.Name.Ident}
+		if _, ok := named.Table.Store[name]; ok {
+			return nil, &EvalError{Message: fmt.Sprintf("%s: argument %s bound twice", funcFrameName(fn), arg.Name.Ident)}
+		}
+		named.Table.Store[name] = value
+		if !isFunc {
+			continue
+		}
+		index := -1
+		for i, param := range fnObj.Func.Parameters {
+			if param.Name.Ident == arg.Name.Ident && !param.IsRest {
+				index = i
 			}
+		}
+		if index < 0 {
+			return nil, &EvalError{Message: fmt.Sprintf("%s: unknown named argument %s", funcFrameName(fn), arg.Name.Ident)}
+		}
+		pos := index - offset
+		if pos < 0 || (pos < len(args) && args[pos] != (missingArg{})) {
+			return nil, &EvalError{Message: fmt.Sprintf("%s: argument %s bound twice", funcFrameName(fn), arg.Name.Ident)}
+		}
+		for len(args) <= pos {
+			args = append(args, missingArg{})
+		}
+		args[pos] = value
+	}
+	if !isFunc {
+		args = append(args, named)
+	}
+	return args, nil
+}
+
+// 按位置绑定参数，缺少的参数使用默认值或 nil，剩余参数收集为 pack。
+// 默认值在调用时求值，可以引用前面的参数
+func bindParameters(fn FuncObj, env *Environment, args []Object) *EvalError {
+	params := fn.Func.Parameters
+	strict := env.interp != nil && env.interp.strictArity
+	if strict {
+		if err := checkArity(fn, len(args)); err != nil {
+			return err
+		}
+	}
+	for i, param := range params {
+		switch {
+		case param.IsRest:
+			rest := []Object{}
+			if i < len(args) {
+				rest = append(rest, args[i:]...)
+			}
+			env.SetNewObj(param.Name.Ident, newPack(rest))
+		case i < len(args) && args[i] != (missingArg{}):
+			env.SetNewObj(param.Name.Ident, args[i])
+		case param.Default != nil:
+			value, err := Eval(param.Default, env)
 			if err != nil {
-				return nil, err
+				return err
 			}
+			env.SetNewObj(param.Name.Ident, value)
+		case strict:
+			return &EvalError{Message: fmt.Sprintf("%s: missing argument %s", funcFrameName(fn), param.Name.Ident)}
+		default:
+			env.SetNewObj(param.Name.Ident, NilObj)
 		}
-		return evalFuncBlockExpr(fnObj.Func.Body, funcCallEnv)
 	}
+	return nil
+}
+
+func checkArity(fn FuncObj, n int) *EvalError {
+	params := fn.Func.Parameters
+	required, max := 0, len(params)
+	for i, param := range params {
+		if param.IsRest {
+			max = -1
+		} else if param.Default == nil {
+			required = i + 1
+		}
+	}
+	var expect string
+	switch {
+	case n >= required && (max < 0 || n <= max):
+		return nil
+	case max < 0:
+		expect = fmt.Sprintf("at least %d", required)
+	case required == max:
+		expect = fmt.Sprintf("%d", required)
+	default:
+		expect = fmt.Sprintf("%d to %d", required, max)
+	}
+	return &EvalError{Message: fmt.Sprintf("%s: expect %s arguments, got %d", funcFrameName(fn), expect, n)}
+}
+
+func evalMethodCallExpr(expr *parser.MethodCallExpr, env *Environment) (Object, *EvalError) {
+	method, args, err := evalMethodCallTarget(expr, env)
+	if err != nil {
+		return nil, err
+	}
+	return callFunction(env.interp, method, args)
+}
+
+func evalMethodCallTarget(expr *parser.MethodCallExpr, env *Environment) (Object, []Object, *EvalError) {
+	receiver, err := Eval(expr.Receiver, env)
+	if err != nil {
+		return nil, nil, err
+	}
+	method, err := lookupMethod(env.interp, receiver, expr.Method.Ident)
+	if err != nil {
+		return nil, nil, err
+	}
+	args := make([]Object, 0, len(expr.Parameters)+1)
+	args = append(args, receiver)
+	args, err = evalArgs(expr.Parameters, env, args)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(expr.NamedArgs) != 0 {
+		if args, err = evalNamedArgs(method, expr.NamedArgs, env, args, 0); err != nil {
+			return nil, nil, err
+		}
+	}
+	return method, args, nil
 }
 
 func evalDeclarationExpr(expr *parser.DeclarationExpr, env *Environment) (Object, *EvalError) {
@@ -426,7 +946,7 @@ func evalAssignExpr(expr *parser.AssignExpr, env *Environment) (Object, *EvalErr
 	}
 	err = declareAssignHelper(expr.Left, value, env,
 		func(ident string, value *Object) *EvalError {
-			if o := env.Get(ident); o == nil {
+			if o := env.getForWrite(ident); o == nil {
 				return &EvalError{Message: fmt.Sprintf("Assign value haven't declare %s", ident)}
 			} else {
 				*o = *value
@@ -439,6 +959,82 @@ func evalAssignExpr(expr *parser.AssignExpr, env *Environment) (Object, *EvalErr
 	return value, nil
 }
 
+func evalCompoundAssignExpr(expr *parser.CompoundAssignExpr, env *Environment) (Object, *EvalError) {
+	_, value, err := updateAssignHelper(expr.Left, env, func(old Object) (Object, *EvalError) {
+		right, err := Eval(expr.Value, env)
+		if err != nil {
+			return nil, err
+		}
+		return evalInfixOperator(env.interp, expr.Op, old, right)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func evalIncDecExpr(expr *parser.IncDecExpr, env *Environment) (Object, *EvalError) {
+	op := lexer.T_PLUS
+	if expr.Op == lexer.T_DEC {
+		op = lexer.T_MINUS
+	}
+	old, _, err := updateAssignHelper(expr.Left, env, func(old Object) (Object, *EvalError) {
+		return evalInfixOperator(env.interp, op, old, IntegerObj{Value: 1})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return old, nil
+}
+
+// 读取旧值并写回新值，赋值目标（变量或表和索引）只求值一次
+func updateAssignHelper(
+	left parser.AssignableExpr,
+	env *Environment,
+	update func(old Object) (Object, *EvalError)) (Object, Object, *EvalError) {
+
+	switch left := left.(type) {
+	case *parser.Identifier:
+		o := env.getForWrite(left.Ident)
+		if o == nil {
+			return nil, nil, &EvalError{Message: fmt.Sprintf("Assign value haven't declare %s", left.Ident)}
+		}
+		old := *o
+		value, err := update(old)
+		if err != nil {
+			return nil, nil, err
+		}
+		*o = value
+		return old, value, nil
+	case *parser.IndexExpr:
+		table, err := Eval(left.Table, env)
+		if err != nil {
+			return nil, nil, err
+		}
+		if table.Type() != TTableObj {
+			return nil, nil, &EvalError{Message: "assign to an index of non table"}
+		}
+		index, err := Eval(left.Index, env)
+		if err != nil {
+			return nil, nil, err
+		}
+		old, err := indexObj(env.interp, table, index)
+		if err != nil {
+			return nil, nil, err
+		}
+		value, err := update(old)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := setIndexObj(env.interp, table, index, value); err != nil {
+			return nil, nil, err
+		}
+		return old, value, nil
+	default:
+		panic("updateAssignHelper unhand left type")
+	}
+}
+
 func declareAssignHelper(
 	left parser.AssignableExpr,
 	value Object,
@@ -456,15 +1052,16 @@ func declareAssignHelper(
 		if err != nil {
 			return err
 		}
-		if table, ok := table.(TableObj); ok {
-			index, err := Eval(left.Index, env)
-			if err != nil {
-				return err
-			}
-			table.Table.Store[index] = value
-		} else {
+		if table.Type() != TTableObj {
 			return &EvalError{Message: "assign to an index of non table"}
 		}
+		index, err := Eval(left.Index, env)
+		if err != nil {
+			return err
+		}
+		if err := setIndexObj(env.interp, table, index, value); err != nil {
+			return err
+		}
 	case *parser.PackExpr:
 		switch value := value.(type) {
 		case PackObj:
@@ -497,7 +1094,13 @@ func declareAssignHelper(
 
 func evalIdentifierExpr(expr *parser.Identifier, env *Environment) (Object, *EvalError) {
 	o := env.Get(expr.Ident)
+	if o == nil && env.interp != nil {
+		o = env.interp.globals.Get(expr.Ident)
+	}
 	if o == nil {
+		if builtin, ok := builtins[expr.Ident]; ok {
+			return builtin, nil
+		}
 		return nil, &EvalError{Message: fmt.Sprintf("evalIdentifierExpr: identifier haven't declare %s", expr.Ident)}
 	} else {
 		return *o, nil
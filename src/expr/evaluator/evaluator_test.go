@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"expr/lexer"
 	"expr/parser"
+	"runtime"
 	"testing"
+	"time"
 )
 
 func TestEnv(t *testing.T) {
@@ -46,6 +48,26 @@ func TestBasicValueEval(t *testing.T) {
 
 }
 
+func TestUnicodeIdentifier(t *testing.T) {
+	testProgram(t, `价格 := 10; 数量 := 3; return 价格 * 数量`, IntegerObj{Value: 30})
+	testProgram(t, `用户 := table{ 名字 = "张三" }; return 用户.名字`, StringObj{Value: "张三"})
+	testProgram(t, `return len("你好，世界")`, IntegerObj{Value: 5})
+}
+
+func TestInterpolatedString(t *testing.T) {
+	testProgram(t, `
+user := table{ name = "Ann" }
+items := [1, 2, 3]
+return "hello ${user.name}, you have ${len(items)} items"`, StringObj{Value: "hello Ann, you have 3 items"})
+	testProgram(t, `x := 1.5; return "${x * 2}|${nil}|${true}|${[1, "a"]}"`, StringObj{Value: "3|nil|true|[1, a]"})
+	testProgram(t, `return "cost: \${price} $5"`, StringObj{Value: "cost: ${price} $5"})
+	testProgram(t, `
+v := setmeta(table{}, table{ __tostring = func(self) return "vec" })
+return "v = ${v}"`, StringObj{Value: "v = vec"})
+	testProgram(t, `name := "world"; return "${ "hello ${name}" }!"`, StringObj{Value: "hello world!"})
+	testProgramError(t, `return "${undefined}"`)
+}
+
 func TestTableEval(t *testing.T) {
 	obj, _ := testProgram(t, `return table{ hello = "world", [false] = 10, [10.2] = true}`, nil)
 	table := obj.(TableObj).Table.Store
@@ -72,6 +94,36 @@ func TestDeclareAssign(t *testing.T) {
 	testProgram(t, `pack := [7,20,30]; [x] := pack; return x`, IntegerObj{Value: 7})
 }
 
+func TestCompoundAssign(t *testing.T) {
+	testProgram(t, `x := 10; x += 5; return x`, IntegerObj{Value: 15})
+	testProgram(t, `x := 10; x -= 5; return x`, IntegerObj{Value: 5})
+	testProgram(t, `x := 10; x *= 2.5; return x`, FloatObj{Value: 25})
+	testProgram(t, `x := 10; x /= 4; return x`, IntegerObj{Value: 2})
+	testProgram(t, `x := 10; x %= 4; return x`, IntegerObj{Value: 2})
+	testProgram(t, `x := 1; y := 2; x += y += 3; return x * 10 + y`, IntegerObj{Value: 65})
+	testProgram(t, `x := 1; return x += 2`, IntegerObj{Value: 3})
+
+	testProgram(t, `t := table{ count = 1 }; t.count += 10; return t.count`, IntegerObj{Value: 11})
+	testProgram(t, `
+calls := table{ n = 0 }
+t := table{ count = 0 }
+get := func()[calls, t] { calls.n++; return t }
+get().count += 1
+get().count += 1
+return calls.n * 10 + t.count`, IntegerObj{Value: 22})
+
+	testProgram(t, `x := 1; x++; return x`, IntegerObj{Value: 2})
+	testProgram(t, `x := 1; x--; return x`, IntegerObj{Value: 0})
+	testProgram(t, `x := 1; return x++`, IntegerObj{Value: 1})
+	testProgram(t, `t := table{ [1] = 5 }; t.[1]++; return t.[1]`, IntegerObj{Value: 6})
+	testProgram(t, `x := 3; return --x`, IntegerObj{Value: 3})
+	testProgram(t, `a := 5; b := 2; return a--b`, IntegerObj{Value: 7})
+
+	testProgramError(t, `x += 1`)
+	testProgramError(t, `x := "a"; x++`)
+	testProgramError(t, `x := 1; x.y += 1`)
+}
+
 func TestArith(t *testing.T) {
 	testProgram(t, `return -1`, IntegerObj{Value: -1})
 	testProgram(t, `return --10`, IntegerObj{Value: 10})
@@ -97,6 +149,81 @@ func TestArith(t *testing.T) {
 	testProgram(t, `return 10 < 20.5`, BooleanObj{Value: true})
 }
 
+func TestExtendArith(t *testing.T) {
+	testProgram(t, `return 7 % 3`, IntegerObj{Value: 1})
+	testProgram(t, `return -7 % 3`, IntegerObj{Value: 2})
+	testProgram(t, `return 7 % -3`, IntegerObj{Value: -2})
+	testProgram(t, `return 7 // 2`, IntegerObj{Value: 3})
+	testProgram(t, `return -7 // 2`, IntegerObj{Value: -4})
+	testProgram(t, `return 7.5 // 2`, FloatObj{Value: 3})
+	testProgram(t, `return 5.5 % 2`, FloatObj{Value: 1.5})
+	testProgram(t, `return -5.5 % 2`, FloatObj{Value: 0.5})
+	testProgram(t, `return 2 ** 10`, IntegerObj{Value: 1024})
+	testProgram(t, `return 2 ** 3 ** 2`, IntegerObj{Value: 512})
+	testProgram(t, `return -2 ** 2`, IntegerObj{Value: -4})
+	testProgram(t, `return 2 ** -1`, FloatObj{Value: 0.5})
+	testProgram(t, `return 4.0 ** 0.5`, FloatObj{Value: 2})
+
+	testProgram(t, `return 6 & 3`, IntegerObj{Value: 2})
+	testProgram(t, `return 6 | 3`, IntegerObj{Value: 7})
+	testProgram(t, `return 6 ^ 3`, IntegerObj{Value: 5})
+	testProgram(t, `return ~0`, IntegerObj{Value: -1})
+	testProgram(t, `return 1 << 4`, IntegerObj{Value: 16})
+	testProgram(t, `return -16 >> 2`, IntegerObj{Value: -4})
+	testProgram(t, `return 1 | 2 << 1`, IntegerObj{Value: 5})
+
+	testProgramError(t, `return 1 // 0`)
+	testProgramError(t, `return 1 % 0`)
+	testProgramError(t, `return 1 / 0`)
+	testProgramError(t, `return 1.5 & 1`)
+	testProgramError(t, `return ~1.5`)
+	testProgramError(t, `return 1 << -1`)
+	testProgramError(t, `return "a" % 2`)
+
+	meta := `t := setmeta(table{}, table{ __mod = func(a, b) return "mod", __bnot = func(a) return "bnot" });`
+	testProgram(t, meta+`return t % 1`, StringObj{Value: "mod"})
+	testProgram(t, meta+`return ~t`, StringObj{Value: "bnot"})
+}
+
+func TestIntegerOverflow(t *testing.T) {
+	big := func(s string) string {
+		return `return tostring(` + s + `)`
+	}
+	testProgram(t, big(`9223372036854775807 + 1`), StringObj{Value: "9223372036854775808"})
+	testProgram(t, big(`-9223372036854775807 - 2`), StringObj{Value: "-9223372036854775809"})
+	testProgram(t, big(`4294967296 * 4294967296`), StringObj{Value: "18446744073709551616"})
+	testProgram(t, big(`2 ** 100`), StringObj{Value: "1267650600228229401496703205376"})
+	testProgram(t, big(`1 << 64`), StringObj{Value: "18446744073709551616"})
+	testProgram(t, big(`-(-9223372036854775807 - 1)`), StringObj{Value: "9223372036854775808"})
+	testProgram(t, big(`(-9223372036854775807 - 1) / -1`), StringObj{Value: "9223372036854775808"})
+	testProgram(t, big(`(-9223372036854775807 - 1) // -1`), StringObj{Value: "9223372036854775808"})
+	testProgram(t, big(`123456789012345678901234567890`), StringObj{Value: "123456789012345678901234567890"})
+
+	testProgram(t, `return 9223372036854775808 - 1`, IntegerObj{Value: 9223372036854775807})
+	testProgram(t, `return -9223372036854775808`, IntegerObj{Value: -9223372036854775808})
+	testProgram(t, `return (2 ** 64) // (2 ** 60)`, IntegerObj{Value: 16})
+	testProgram(t, `return -(2 ** 64) % 7`, IntegerObj{Value: 5})
+	testProgram(t, `return (2 ** 64) >> 60`, IntegerObj{Value: 16})
+	testProgram(t, `return (2 ** 64) == 18446744073709551616`, BooleanObj{Value: true})
+	testProgram(t, `return (2 ** 64) > 9223372036854775807`, BooleanObj{Value: true})
+	testProgram(t, `return (2 ** 64) < 1.0`, BooleanObj{Value: false})
+	testProgram(t, `return (2 ** 64) * 0.5`, FloatObj{Value: 9223372036854775808})
+	testProgram(t, `x := 9223372036854775807; x += 1; x -= 1; return x`, IntegerObj{Value: 9223372036854775807})
+
+	testProgramError(t, `return (2 ** 64) // 0`)
+	testProgramError(t, `t := table{}; t.[2 ** 64] = 1`)
+
+	// 结果过大的 ** 和 << 在计算之前报错
+	testProgramError(t, `return 3 ** 1000000000`)
+	testProgramError(t, `return (2 ** 64) ** 1000000`)
+	testProgramError(t, `return 1 << 4000000000`)
+	testProgramError(t, `return (2 ** 64) << 2000000000`)
+	testProgram(t, `return try 3 ** 1000000000 catch e break e.message`, StringObj{Value: "result of operator ** too large"})
+	testProgram(t, `return try 1 << 4000000000 catch e break e.message`, StringObj{Value: "result of operator << too large"})
+	testProgram(t, `return 1 ** 4000000000 + (-1) ** 4000000001 + 0 << 4000000000`, IntegerObj{Value: 0})
+	testProgram(t, `return (2 ** 2000000) >> 1999999`, IntegerObj{Value: 2})
+}
+
 func TestIndex(t *testing.T) {
 	testProgram(t, `t := table{ str = 10 }; return t.str`, IntegerObj{Value: 10})
 	testProgram(t, `t := table{ str = 10 }; return t.world`, NilObj)
@@ -144,6 +271,415 @@ return f3() + f4()
 `, IntegerObj{Value: 13})
 }
 
+func TestBuiltin(t *testing.T) {
+	testProgram(t, `return len("hello")`, IntegerObj{Value: 5})
+	testProgram(t, `return len([1,2,3])`, IntegerObj{Value: 3})
+	testProgram(t, `return len(table{ a = 1, b = 2 })`, IntegerObj{Value: 2})
+	testProgram(t, `return tostring(10)`, StringObj{Value: "10"})
+	testProgram(t, `return tostring([1, 2.5, "a", nil])`, StringObj{Value: "[1, 2.5, a, nil]"})
+	testProgram(t, `len := func(x){ return 0 }; return len("hello")`, IntegerObj{Value: 0})
+}
+
+func TestMetaTable(t *testing.T) {
+	vector := `
+mt := table{}
+vec := func(x, y)[mt] return setmeta(table{ x = x, y = y }, mt)
+mt.__add = func(a, b)[vec] return vec(a.x + b.x, a.y + b.y)
+mt.__sub = func(a, b)[vec] return vec(a.x - b.x, a.y - b.y)
+mt.__unm = func(a)[vec] return vec(-a.x, -a.y)
+mt.__eq = func(a, b) return a.x == b.x and a.y == b.y
+mt.__lt = func(a, b) return a.x * a.x + a.y * a.y < b.x * b.x + b.y * b.y
+mt.__len = func(a) return 2
+mt.__tostring = func(a) return "vec"
+`
+	testProgram(t, vector+`v := vec(1, 2) + vec(3, 4); return v.x`, IntegerObj{Value: 4})
+	testProgram(t, vector+`v := vec(1, 2) - vec(3, 5); return v.y`, IntegerObj{Value: -3})
+	testProgram(t, vector+`v := -vec(1, 2); return v.x`, IntegerObj{Value: -1})
+	testProgram(t, vector+`return vec(1, 2) == vec(1, 2)`, BooleanObj{Value: true})
+	testProgram(t, vector+`return vec(1, 2) != vec(1, 2)`, BooleanObj{Value: false})
+	testProgram(t, vector+`return vec(1, 2) < vec(3, 4)`, BooleanObj{Value: true})
+	testProgram(t, vector+`return vec(1, 2) > vec(3, 4)`, BooleanObj{Value: false})
+	testProgram(t, vector+`return vec(1, 2) <= vec(1, 2)`, BooleanObj{Value: true})
+	testProgram(t, vector+`return vec(1, 2) >= vec(3, 4)`, BooleanObj{Value: false})
+	testProgram(t, vector+`return len(vec(1, 2))`, IntegerObj{Value: 2})
+	testProgram(t, vector+`return tostring(vec(1, 2))`, StringObj{Value: "vec"})
+	testProgram(t, vector+`v := vec(1, 2); return getmeta(v) == mt`, BooleanObj{Value: true})
+	testProgram(t, `return getmeta(table{})`, NilObj)
+
+	testProgram(t, `
+base := table{ greet = "hello" }
+t := setmeta(table{}, table{ __index = base })
+return t.greet`, StringObj{Value: "hello"})
+	testProgram(t, `
+t := setmeta(table{}, table{ __index = func(t, k) return k })
+return t.anything`, StringObj{Value: "anything"})
+	testProgram(t, `
+log := table{ n = 0 }
+proxy := setmeta(table{}, table{ __newindex = func(t, k, v)[log] { log.n = log.n + v } })
+proxy.x = 10
+proxy.y = 5
+return log.n`, IntegerObj{Value: 15})
+	testProgram(t, `
+adder := setmeta(table{ base = 10 }, table{ __call = func(self, x) return self.base + x })
+return adder(5)`, IntegerObj{Value: 15})
+
+	obj, _ := testProgram(t, `
+store := table{}
+proxy := setmeta(table{}, table{ __newindex = store })
+proxy.x = 10
+return [proxy.x, store.x]`, nil)
+	if pack := obj.(PackObj).Pack.Objs; pack[0] != NilObj || pack[1] != (IntegerObj{Value: 10}) {
+		t.Errorf("TestMetaTable __newindex error")
+	}
+}
+
+func TestMethodCall(t *testing.T) {
+	testProgram(t, `
+counter := table{ n = 0 }
+counter.add = func(self, x) { self.n = self.n + x; return self }
+counter:add(1):add(2)
+return counter.n`, IntegerObj{Value: 3})
+	testProgram(t, `
+Account := table{}
+Account.balance = func(self) return self.amount
+acc := setmeta(table{ amount = 100 }, Account)
+return acc:balance()`, IntegerObj{Value: 100})
+	testProgram(t, `
+Base := table{ name = func(self) return "base" }
+acc := setmeta(table{}, table{ __index = Base })
+return acc:name()`, StringObj{Value: "base"})
+	testProgram(t, `
+calls := table{ n = 0 }
+get := func()[calls] { calls.n = calls.n + 1; return table{ id = func(self) return 1 } }
+get():id()
+return calls.n`, IntegerObj{Value: 1})
+
+	testProgramError(t, `t := table{}; return t:missing()`)
+	testProgramError(t, `x := 10; return x:method()`)
+}
+
+func TestTryCatch(t *testing.T) {
+	testProgram(t, `return try { break 1 } catch _ { break 2 }`, IntegerObj{Value: 1})
+	testProgram(t, `return try { throw "boom" } catch e { break e.message }`, StringObj{Value: "boom"})
+	testProgram(t, `return try throw table{ code = 42 } catch e break e.data.code`, IntegerObj{Value: 42})
+	testProgram(t, `return try throw table{ message = "bad input" } catch e break e.message`, StringObj{Value: "bad input"})
+	testProgram(t, `return try throw error("failed", 7) catch e break "${e.message} ${e.data}"`, StringObj{Value: "failed 7"})
+	testProgram(t, `return try { x := 1 / 0 } catch e { break e.message }`, StringObj{Value: "integer divide by zero"})
+	testProgram(t, `return try { x := 1; x.a } catch e { break e.message }`, StringObj{Value: "eval an index of non table"})
+	testProgram(t, `return try { len(1) } catch e { break e.message }`, StringObj{Value: "len: wrong argument type TIntegerObj"})
+	testProgram(t, `return try undefinedVar catch e break e.data`, NilObj)
+	testProgram(t, `
+f := func() { if true { return 1 }; return 2 }
+return try f() catch _ { break 0 }`, NilObj)
+	testProgram(t, `
+f := func(n) { if n > 2 { throw "too deep" }; return 1 }
+g := func()[f] { return try f(3) catch e { return e.message } }
+return g()`, StringObj{Value: "too deep"})
+	testProgram(t, `
+inner := func() throw "inner"
+outer := func()[inner] inner()
+return try outer() catch e { [a, b] := e.traceback; break "${a}|${b}" }`, StringObj{Value: "func at line 2|func at line 3"})
+	testProgram(t, `
+r := try { try throw "a" catch e throw e } catch e2 { break e2.message }
+return r`, StringObj{Value: "a"})
+	testProgram(t, `return tostring(try throw "x" catch e break e)`, StringObj{Value: "error: x"})
+
+	err := testProgramError(t, `throw "uncaught"`)
+	if err == nil || err.Message != "uncaught" || err.Value == nil {
+		t.Errorf("uncaught throw error mismatch: %v", err)
+	}
+	testProgramError(t, `try throw "a" catch e throw e.message + 1`)
+}
+
+func TestFuncParameters(t *testing.T) {
+	testProgram(t, `f := func(x, y = 10) return x + y; return f(1) + f(1, 2)`, IntegerObj{Value: 14})
+	testProgram(t, `f := func(x, y = x * 2) return y; return f(3)`, IntegerObj{Value: 6})
+	testProgram(t, `f := func(x = 1) return x; return f(nil)`, NilObj)
+	testProgram(t, `
+base := 100
+f := func(x = base)[base] return x
+return f()`, IntegerObj{Value: 100})
+	testProgram(t, `
+sum := func(...nums) { total := 0; for n in nums { total += n }; return total }
+return sum(1, 2, 3) + sum()`, IntegerObj{Value: 6})
+	testProgram(t, `f := func(first, ...rest) return tostring(rest); return f(1, 2, 3)`, StringObj{Value: "[2, 3]"})
+	testProgram(t, `f := func(first, ...rest) return tostring(rest); return f()`, StringObj{Value: "[]"})
+	testProgram(t, `
+f := func(a, b, c) return "${a}${b}${c}"
+args := [2, 3]
+return f(1, ...args)`, StringObj{Value: "123"})
+	testProgram(t, `
+f := func(...all) return len(all)
+return f(...[1, 2], 3, ...[], ...[4])`, IntegerObj{Value: 4})
+	testProgram(t, `
+obj := table{ n = 1 }
+obj.add = func(self, ...xs) { for x in xs { self.n += x }; return self.n }
+return obj:add(...[2, 3])`, IntegerObj{Value: 6})
+	testProgram(t, `f := func(a, b) return b; return f(1, 2, 3)`, IntegerObj{Value: 2})
+
+	testProgramError(t, `f := func(...xs) 1; f(...1)`)
+	testProgramError(t, `x := ...[1]`)
+	testProgramError(t, `f := func(x = undefinedVar) 1; f()`)
+}
+
+func TestNamedArgs(t *testing.T) {
+	testProgram(t, `
+connect := func(host, port = 80, timeout = 30) return "${host}:${port}/${timeout}"
+return "${connect("a", timeout = 5)} ${connect(host = "b")} ${connect("c", 1, timeout = 2)}"`,
+		StringObj{Value: "a:80/5 b:80/30 c:1/2"})
+	testProgram(t, `
+f := func(a, b, c) return "${a}${b}${c}"
+return f(c = 3, a = 1)`, StringObj{Value: "1nil3"})
+	testProgram(t, `
+obj := table{ n = 1 }
+obj.add = func(self, x = 0, y = 0) return self.n + x * 10 + y
+return obj:add(y = 2)`, IntegerObj{Value: 3})
+	testProgram(t, `
+f := func(a, ...rest) return "${a} ${tostring(rest)}"
+return f(a = 1)`, StringObj{Value: "1 []"})
+	testProgram(t, `
+callable := setmeta(table{}, table{ __call = func(self, x, y = 2) return x * y })
+return callable(y = 5, x = 3)`, IntegerObj{Value: 15})
+	testProgram(t, `
+h := table{}
+h.count = func(n, acc = 0)[h] { if n == 0 { return acc }; return h.count(n - 1, acc = acc + 1) }
+return h.count(10)`, IntegerObj{Value: 10})
+
+	for input, message := range map[string]string{
+		`f := func(a) 1; f(b = 1)`:                                           "func at line 1: unknown named argument b",
+		`f := func(a) 1; f(a = 1, a = 2)`:                                    "func at line 1: argument a bound twice",
+		`f := func(a) 1; f(1, a = 2)`:                                        "func at line 1: argument a bound twice",
+		`f := func(...rest) 1; f(rest = 1)`:                                  "func at line 1: unknown named argument rest",
+		`c := setmeta(table{}, table{ __call = func(self) 1 }); c(self = 1)`: "func at line 1: argument self bound twice",
+	} {
+		if err := testProgramError(t, input); err != nil && err.Message != message {
+			t.Errorf("input %s: expect error %s, got %s", input, message, err.Message)
+		}
+	}
+}
+
+func TestTailCall(t *testing.T) {
+	testProgram(t, `
+h := table{}
+h.loop = func(n, acc)[h] { if n == 0 { return acc }; return h.loop(n - 1, acc + 1) }
+return h.loop(1000000, 0)`, IntegerObj{Value: 1000000})
+	testProgram(t, `
+h := table{}
+h.even = func(n)[h] { if n == 0 { return true }; return h.odd(n - 1) }
+h.odd = func(n)[h] { if n == 0 { return false }; return h.even(n - 1) }
+return h.even(100001)`, BooleanObj{Value: false})
+	testProgram(t, `
+obj := table{ n = 0 }
+obj.count = func(self, n) { if n == 0 { return self.n }; self.n += 1; return self:count(n - 1) }
+return obj:count(100000)`, IntegerObj{Value: 100000})
+	testProgram(t, `
+h := table{}
+h.sum = func(n, acc)[h] { for i := 0; i < 1; i++ { if n == 0 { return acc } }; return h.sum(n - 1, acc + n) }
+return h.sum(100000, 0)`, IntegerObj{Value: 5000050000})
+	// try 中的 return 不是尾调用，被调用函数的错误仍然被捕获
+	testProgram(t, `
+fail := func() throw "boom"
+f := func()[fail] { try { return fail() } catch e { return "caught ${e.message}" } }
+return f()`, StringObj{Value: "caught boom"})
+	testProgram(t, `
+log := table{ s = "" }
+g := func()[log] { log.s = "${log.s}g" }
+f := func()[log, g] { defer log.s = "${log.s}d"; return g() }
+f()
+return log.s`, StringObj{Value: "gd"})
+	testProgram(t, `
+inner := func() throw "inner"
+outer := func()[inner] { return inner() }
+return try outer() catch e { [a, b] := e.traceback; break "${a}|${b}" }`, StringObj{Value: "func at line 2|func at line 3"})
+	testProgram(t, `
+inner := func() throw "inner"
+middle := func()[inner] { return inner() }
+outer := func()[middle] { return middle() }
+return try outer() catch e { [a, b] := e.traceback; break "${len(e.traceback)} ${a}|${b}" }`, StringObj{Value: "2 func at line 2|func at line 4"})
+	testProgram(t, `f := func() return len([1, 2]); return f()`, IntegerObj{Value: 2})
+}
+
+func TestDefer(t *testing.T) {
+	testProgram(t, `
+log := table{ s = "" }
+f := func()[log] {
+	defer log.s = "${log.s}1"
+	defer log.s = "${log.s}2"
+	log.s = "${log.s}body"
+}
+f()
+return log.s`, StringObj{Value: "body21"})
+	testProgram(t, `
+log := table{ s = "" }
+f := func(x)[log] {
+	defer log.s = "${log.s}deferred"
+	if x { return "early" }
+	log.s = "${log.s}late;"
+	return "normal"
+}
+r := f(true)
+return "${r} ${log.s}"`, StringObj{Value: "early deferred"})
+	testProgram(t, `
+log := table{ s = "" }
+f := func()[log] { defer log.s = "${log.s}d"; break 1 }
+return "${f()} ${log.s}"`, StringObj{Value: "1 d"})
+	testProgram(t, `
+log := table{ s = "" }
+f := func()[log] {
+	defer log.s = "${log.s}cleanup"
+	x := 1 / 0
+}
+m := try f() catch e break e.message
+return "${m} ${log.s}"`, StringObj{Value: "integer divide by zero cleanup"})
+	testProgram(t, `
+log := table{ n = 0 }
+f := func()[log] { if true { defer log.n += 1 }; log.n *= 10 }
+f(); f()
+return log.n`, IntegerObj{Value: 11})
+	testProgram(t, `
+f := func() { defer throw "from defer"; return 1 }
+return try f() catch e break e.message`, StringObj{Value: "from defer"})
+	testProgram(t, `
+log := table{ s = "" }
+f := func()[log] { defer log.s = "${log.s}a"; defer throw "x"; defer log.s = "${log.s}b" }
+try f() catch _ 0
+return log.s`, StringObj{Value: "ba"})
+	obj, _ := testProgram(t, `
+log := table{ s = "" }
+defer log.s = "${log.s}!"
+return log`, nil)
+	if s := obj.(TableObj).Table.Store[StringObj{Value: "s"}]; s != (StringObj{Value: "!"}) {
+		t.Errorf("top level defer should run after return, got %v", s)
+	}
+	testProgram(t, `
+log := table{ s = "" }
+f := func()[log] {
+	defer { defer log.s = "${log.s}inner;"; log.s = "${log.s}outer;" }
+	log.s = "${log.s}body;"
+}
+f()
+return log.s`, StringObj{Value: "body;outer;inner;"})
+	testProgram(t, `
+inner := func() throw "original"
+f := func()[inner] { defer throw "from defer"; inner() }
+return try f() catch e { [a, b, c] := e.traceback; break "${e.message}|${a}|${b}" }`,
+		StringObj{Value: "from defer|while handling error: original|func at line 2"})
+}
+
+func TestForLoop(t *testing.T) {
+	testProgram(t, `sum := 0; for i := 1; i <= 10; i++ { sum += i }; return sum`, IntegerObj{Value: 55})
+	testProgram(t, `sum := 0; for i := 1; true; i++ { sum += i; if i == 3 { return sum } }`, IntegerObj{Value: 6})
+	testProgram(t, `return for i := 1; i < 10; i++ { break i * 100 }`, IntegerObj{Value: 100})
+	testProgramError(t, `for i := 0; i < 3; i++ { x := i }; return i`)
+	testProgram(t, `sum := 0; for v in [1, 2, 3] { sum += v }; return sum`, IntegerObj{Value: 6})
+	testProgram(t, `s := ""; for v, i in ["a", "b"] { s = "${s}${i}${v}" }; return s`, StringObj{Value: "1a2b"})
+	testProgram(t, `s := ""; for k, v in table{ b = 2, a = 1 } { s = "${s}${k}${v}" }; return s`, StringObj{Value: "a1b2"})
+	testProgram(t, `n := 0; for v in [1, 2, 3] { n += v; break 0 }; return n`, IntegerObj{Value: 1})
+	testProgram(t, `
+c := table{ n = 0 }
+next := func()[c] { c.n++; if c.n <= 3 { return c.n } }
+sum := 0
+for v in next { sum += v }
+return sum`, IntegerObj{Value: 6})
+	testProgramError(t, `for v in 10 {}`)
+}
+
+func TestGenerator(t *testing.T) {
+	testProgram(t, `gen := func() { s := "got ${yield 1}"; yield s }; g := gen(); g.next(); return g.next("v")`, StringObj{Value: "got v"})
+	testProgram(t, `
+count := func(n) { for i := 1; i <= n; i++ { yield i } }
+s := ""
+for v in count(3) { s = "${s}${v}" }
+return s`, StringObj{Value: "123"})
+	testProgram(t, `
+gen := func() { yield "a"; yield "b" }
+g := gen()
+a := g.next(); b := g:next(); c := g.next()
+return "${a}${b}${c} ${g.done}"`, StringObj{Value: "abnil true"})
+	testProgram(t, `
+fib := func() { a := 0; b := 1; for i := 0; true; i++ { yield a; [a, b] = [b, a + b] } }
+s := ""
+for v in fib() { if v > 20 { return s }; s = "${s}${v} " }`, StringObj{Value: "0 1 1 2 3 5 8 13 "})
+	testProgram(t, `
+acc := func() { total := 0; for i := 0; true; i++ { total += yield total } }
+g := acc()
+g.next(); g.next(5); g.next(10)
+return g.next(1)`, IntegerObj{Value: 16})
+	testProgram(t, `
+log := table{ s = "" }
+gen := func()[log] { defer log.s = "${log.s}closed"; yield 1; yield 2; log.s = "${log.s}unreachable" }
+for v in gen() { log.s = "${log.s}${v};"; return log.s }`, StringObj{Value: "1;"})
+	testProgram(t, `
+log := table{ s = "" }
+gen := func()[log] { defer log.s = "${log.s}closed"; try { yield 1; yield 2 } catch e { log.s = "caught" } }
+f := func()[gen, log] { for v in gen() { return v } }
+f()
+return log.s`, StringObj{Value: "closed"})
+	testProgram(t, `
+gen := func() { yield 1 }
+g := gen()
+g.close()
+return "${g.done} ${g.next()}"`, StringObj{Value: "true nil"})
+	testProgram(t, `
+gen := func() { yield 1; throw "bad" }
+g := gen()
+g.next()
+return try g.next() catch e break "${e.message} ${g.done}"`, StringObj{Value: "bad true"})
+	testProgram(t, `
+outer := func() { inner := func() { yield 1; yield 2 }; for v in inner() { yield v * 10 } }
+s := ""; for v in outer() { s = "${s}${v}," }; return s`, StringObj{Value: "10,20,"})
+}
+
+func TestGeneratorNoLeak(t *testing.T) {
+	base := runtime.NumGoroutine()
+	testProgram(t, `
+gen := func() { for i := 0; true; i++ { yield 1 } }
+for i := 0; i < 50; i++ { g := gen(); g.next() }
+for i := 0; i < 50; i++ { for v in gen() { break 0 } }`, nil)
+	// 生成器通过捕获的表引用自身时不会被回收，由解释器的 Close 结束
+	in := NewInterpreter()
+	keep, err := in.ExecString(`
+gen := func() { for i := 0; true; i++ { yield 1 } }
+for i := 0; i < 50; i++ {
+	h := table{}
+	cyclic := func()[h] { for i := 0; true; i++ { yield h } }
+	g := cyclic(); h.g = g; g.next()
+	c := coroutine.create(func()[h] { coroutine.yield(h) }); h.c = c; coroutine.resume(c)
+}
+keep := gen(); keep.next()
+return keep`)
+	if err != nil {
+		t.Fatalf("run error: %v", err)
+	}
+	in.Close()
+	in.Bind("keep", keep)
+	testLib(t, in, `return keep.done and keep.next() == nil`, BooleanObj{Value: true})
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > base && time.Now().Before(deadline) {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > base {
+		t.Errorf("generator goroutines leaked: %d > %d", n, base)
+	}
+}
+
+func testProgramError(t *testing.T, input string) *EvalError {
+	inputReader := bytes.NewBufferString(input)
+	l := lexer.New(inputReader)
+	p := parser.New(l)
+	block := p.ParseProgram()
+	if p.Errors != nil {
+		t.Errorf("parse Error input: %s", input)
+		return nil
+	}
+	_, err := evalFuncBlockExpr(block, NewEnv())
+	if err == nil {
+		t.Errorf("expect Eval Error input: %s", input)
+	}
+	return err
+}
+
 func testProgram(t *testing.T, input string, expect Object) (Object, *Environment) {
 	inputReader := bytes.NewBufferString(input)
 	l := lexer.New(inputReader)
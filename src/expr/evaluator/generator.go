@@ -0,0 +1,122 @@
+package evaluator
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// 生成器函数被调用时不执行函数体，而是返回 GeneratorObj，每次 next 执行到下一个 yield。
+// 生成器对象被回收或所属的解释器 Close 时挂起的 goroutine 会被 kill，不会泄漏
+func newGenerator(owner *coRegistry, body func(co *coroutine) (Object, *EvalError)) GeneratorObj {
+	co := newCoroutine(owner, func(co *coroutine, args []Object) (Object, *EvalError) {
+		return body(co)
+	})
+	gen := &GeneratorValue{co: co}
+	runtime.SetFinalizer(gen, func(gen *GeneratorValue) {
+		gen.co.kill()
+	})
+	return GeneratorObj{Gen: gen}
+}
+
+// 返回下一个值，ok 为 false 表示生成器已经结束
+func (gen *GeneratorValue) next(args []Object) (Object, bool, *EvalError) {
+	if gen.co.status == coDead {
+		return NilObj, false, nil
+	}
+	values, done, err := gen.co.resume(args)
+	if err != nil {
+		return nil, false, err
+	}
+	if done {
+		return NilObj, false, nil
+	}
+	return values[0], true, nil
+}
+
+func (gen *GeneratorValue) close() *EvalError {
+	return gen.co.close()
+}
+
+// 生成器的字段：next([v]) 返回下一个值，结束后返回 nil，v 作为 yield 表达式的值；
+// close() 提前结束生成器并执行其中的 defer；done 表示生成器是否已经结束
+func indexGeneratorObj(g GeneratorObj, index Object) Object {
+	key, _ := index.(StringObj)
+	switch key.Value {
+	case "next":
+		return NewNativeFunc("generator.next", func(args []Object) (Object, *EvalError) {
+			// 以方法调用时第一个参数是生成器自身
+			if len(args) != 0 && args[0] == g {
+				args = args[1:]
+			}
+			obj, _, err := g.Gen.next(args)
+			return obj, err
+		})
+	case "close":
+		return NewNativeFunc("generator.close", func(args []Object) (Object, *EvalError) {
+			return NilObj, g.Gen.close()
+		})
+	case "done":
+		return BooleanObj{Value: g.Gen.co.status == coDead}
+	}
+	return NilObj
+}
+
+// iterator 是 for ... in 遍历的统一接口
+type iterator struct {
+	next  func() ([]Object, bool, *EvalError)
+	close func() *EvalError
+}
+
+// pack 产生 (value, index)，table 按 sortedKeys 的顺序产生 (key, value)，
+// 生成器产生 yield 的值，通道产生收到的值直到关闭，函数被反复调用直到返回 nil
+func newIterator(in *Interpreter, obj Object) (*iterator, *EvalError) {
+	noClose := func() *EvalError { return nil }
+	switch obj := obj.(type) {
+	case PackObj:
+		i := 0
+		return &iterator{next: func() ([]Object, bool, *EvalError) {
+			if i >= len(obj.Pack.Objs) {
+				return nil, false, nil
+			}
+			i++
+			return []Object{obj.Pack.Objs[i-1], IntegerObj{Value: int64(i)}}, true, nil
+		}, close: noClose}, nil
+	case GeneratorObj:
+		return &iterator{next: func() ([]Object, bool, *EvalError) {
+			v, ok, err := obj.Gen.next(nil)
+			return []Object{v}, ok, err
+		}, close: obj.Gen.close}, nil
+	case ChanObj:
+		return &iterator{next: func() ([]Object, bool, *EvalError) {
+			v, ok := obj.Chan.recv()
+			return []Object{v}, ok, nil
+		}, close: noClose}, nil
+	case TableObj:
+		if isCallable(obj) {
+			break
+		}
+		keys := sortedKeys(obj.Table)
+		i := 0
+		return &iterator{next: func() ([]Object, bool, *EvalError) {
+			for i < len(keys) {
+				k := keys[i]
+				i++
+				// 遍历过程中被删除的键跳过
+				if v, ok := obj.Table.Store[k]; ok {
+					return []Object{k, v}, true, nil
+				}
+			}
+			return nil, false, nil
+		}, close: noClose}, nil
+	}
+	if isCallable(obj) {
+		return &iterator{next: func() ([]Object, bool, *EvalError) {
+			v, err := callFunction(in, obj, nil)
+			if err != nil {
+				return nil, false, err
+			}
+			return []Object{v}, v != NilObj, nil
+		}, close: noClose}, nil
+	}
+	return nil, &EvalError{Message: fmt.Sprintf("for in: %s is not iterable", obj.Type())}
+}
@@ -0,0 +1,163 @@
+package evaluator
+
+import (
+	"errors"
+	"expr/lexer"
+	"expr/parser"
+	"io"
+	"io/fs"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Interpreter 持有宿主注册的全局变量和标准库，多次运行共享同一份全局环境。
+// 全局变量在脚本的任何位置都可见，函数不需要显式捕获。
+type Interpreter struct {
+	globals *Environment
+	rand    *rand.Rand
+	clock   Clock
+	fs      fs.FS
+	writeFS WritableFS
+
+	loader  ModuleLoader
+	modules map[string]Object      // 已加载模块的导出值
+	loading map[string]*moduleLoad // 正在被某个任务加载的模块
+
+	gil  sync.Mutex // 求值脚本时持有，阻塞操作期间释放，同一时刻只有一个任务在求值
+	task *task      // 持有 gil 的任务
+
+	coroutines coRegistry // 已经启动、尚未结束的生成器和协程
+
+	strictArity bool // 调用脚本函数时参数个数必须与形参匹配
+}
+
+type Option func(in *Interpreter)
+
+// WithStrictArity 开启严格参数检查：调用脚本函数时缺少没有默认值的参数，
+// 或在没有剩余参数时传入多余的参数都会报错，默认缺少的参数为 nil，多余的参数被忽略
+func WithStrictArity() Option {
+	return func(in *Interpreter) {
+		in.strictArity = true
+	}
+}
+
+// WithSharedGlobals 以冻结的 env 作为全局环境的外层。多个解释器可以共享同一个 env 并发运行，
+// 各自的标准库和 Bind 的变量写入自己的全局环境，env 中的脚本函数从调用方的全局环境查找变量和模块。
+// env 必须在共享之前调用 Freeze，其中的原生函数需要自行保证并发安全
+func WithSharedGlobals(env *Environment) Option {
+	if !env.frozen {
+		panic("WithSharedGlobals: environment is not frozen")
+	}
+	return func(in *Interpreter) {
+		in.globals.Outer = env
+	}
+}
+
+func NewInterpreter(opts ...Option) *Interpreter {
+	in := &Interpreter{
+		globals: NewEnv(),
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		clock:   systemClock{},
+		modules: make(map[string]Object),
+		loading: make(map[string]*moduleLoad),
+	}
+	in.globals.interp = in
+	for _, opt := range opts {
+		opt(in)
+	}
+	in.openStdlib()
+	return in
+}
+
+func (in *Interpreter) openStdlib() {
+	in.Bind("string", newStringLib())
+	in.Bind("math", newMathLib(in))
+	in.Bind("pack", newPackLib(in))
+	in.Bind("table", newTableLib(in))
+	in.Bind("json", newJSONLib())
+	in.Bind("re", newRegexpLib(in))
+	in.Bind("time", newTimeLib(in))
+	in.Bind("coroutine", newCoroutineLib(in))
+	in.BindFunc("spawn", in.spawn)
+	in.BindFunc("await", awaitTask)
+	in.BindFunc("chan", in.newChan)
+	in.BindFunc("recv_any", in.recvAny)
+	in.BindFunc("waitgroup", in.newWaitGroup)
+	if in.fs != nil {
+		in.Bind("io", newIOLib(in))
+	}
+}
+
+func (in *Interpreter) Globals() *Environment {
+	return in.globals
+}
+
+func (in *Interpreter) Bind(name string, obj Object) {
+	in.globals.SetNewObj(name, obj)
+}
+
+func (in *Interpreter) BindFunc(name string, fn NativeFunc) {
+	in.Bind(name, NewNativeFunc(name, fn))
+}
+
+// NewModule 把一组原生函数包装成表，函数名为 "module.func"
+func NewModule(name string, funcs map[string]NativeFunc) TableObj {
+	table := &TableValue{Store: make(map[Object]Object)}
+	for fnName, fn := range funcs {
+		table.Store[StringObj{Value: fnName}] = NewNativeFunc(name+"."+fnName, fn)
+	}
+	return TableObj{Table: table}
+}
+
+// Run 持有 gil 运行脚本，同一个解释器上的多次 Run 依次执行。
+// 脚本 spawn 的任务可能在 Run 返回后继续运行，宿主之后访问脚本对象需要通过 Run 或 Call，
+// 直接读写脚本返回的表、调用 CallFunction 会与这些任务并发执行
+func (in *Interpreter) Run(program *parser.BlockExpr) (Object, *EvalError) {
+	return in.runTask(func() (Object, *EvalError) {
+		return evalFuncBlockExpr(program, NewInnerEnv(in.globals))
+	})
+}
+
+// Call 持有 gil 调用脚本返回的函数，用于宿主在 Run 之外回调脚本，
+// 其中可以使用通道、await 和协程。原生函数中已经持有 gil，应当使用 CallFunction
+func (in *Interpreter) Call(fn Object, args ...Object) (Object, *EvalError) {
+	return in.runTask(func() (Object, *EvalError) {
+		return callFunction(in, fn, args)
+	})
+}
+
+func (in *Interpreter) runTask(fn func() (Object, *EvalError)) (Object, *EvalError) {
+	in.gil.Lock()
+	defer in.gil.Unlock()
+	in.task = &task{in: in}
+	defer func() { in.task = nil }()
+	return fn()
+}
+
+func (in *Interpreter) Exec(reader io.Reader) (Object, error) {
+	p := parser.New(lexer.New(reader))
+	program := p.ParseProgram()
+	if len(p.Errors) != 0 {
+		return nil, errors.Join(p.Errors...)
+	}
+	obj, err := in.Run(program)
+	if err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (in *Interpreter) ExecString(src string) (Object, error) {
+	return in.Exec(strings.NewReader(src))
+}
+
+// Close 结束解释器中所有挂起的生成器和协程，其中的 defer 不会执行，之后 resume 它们会报错。
+// 引用了自身的生成器和协程不会被垃圾回收，不再使用解释器时应当调用 Close。
+// Close 需要获取 gil，不能在脚本运行期间调用
+func (in *Interpreter) Close() {
+	in.gil.Lock()
+	defer in.gil.Unlock()
+	in.coroutines.killAll()
+}
@@ -0,0 +1,104 @@
+package evaluator
+
+import (
+	"runtime"
+)
+
+// coroutine 模块：create(fn) 创建协程，resume(co, args...) 运行到下一次 yield 或结束，
+// 返回 yield 的值组成的 pack，函数结束时 pack 中是返回值；
+// yield(values...) 挂起当前协程，返回下一次 resume 传入的参数组成的 pack。
+// close(co) 提前结束挂起的协程，status(co) 返回 suspended、running、normal 或 dead。
+// 协程中的错误由 resume 抛出，协程随之结束。解释器 Close 时挂起的协程被结束
+func newCoroutineLib(in *Interpreter) TableObj {
+	return NewModule("coroutine", map[string]NativeFunc{
+		"create": func(args []Object) (Object, *EvalError) {
+			fn, err := argCallable("coroutine.create", args, 0)
+			if err != nil {
+				return nil, err
+			}
+			co := newCoroutine(&in.coroutines, func(co *coroutine, args []Object) (Object, *EvalError) {
+				return callFunction(in, fn, args)
+			})
+			value := &CoroutineValue{co: co}
+			runtime.SetFinalizer(value, func(value *CoroutineValue) {
+				value.co.kill()
+			})
+			return CoroutineObj{Co: value}, nil
+		},
+		"resume": func(args []Object) (Object, *EvalError) {
+			co, err := argCoroutine("coroutine.resume", args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return in.resumeCoroutine(co, args[1:])
+		},
+		"yield": func(args []Object) (Object, *EvalError) {
+			if in.task == nil {
+				return nil, errNoTask("coroutine.yield")
+			}
+			coroutines := in.task.coroutines
+			if len(coroutines) == 0 {
+				return nil, &EvalError{Message: "coroutine.yield: attempt to yield from outside a coroutine"}
+			}
+			co := coroutines[len(coroutines)-1]
+			values, err := co.yield(args)
+			if err != nil {
+				return nil, err
+			}
+			return newPack(values), nil
+		},
+		"status": func(args []Object) (Object, *EvalError) {
+			co, err := argCoroutine("coroutine.status", args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return StringObj{Value: co.status.String()}, nil
+		},
+		"close": func(args []Object) (Object, *EvalError) {
+			co, err := argCoroutine("coroutine.close", args, 0)
+			if err != nil {
+				return nil, err
+			}
+			return NilObj, co.close()
+		},
+	})
+}
+
+// resumeCoroutine 维护当前任务的协程栈，唤醒者在被唤醒的协程让出之前处于 normal 状态
+func (in *Interpreter) resumeCoroutine(co *coroutine, args []Object) (Object, *EvalError) {
+	t := in.task
+	if t == nil {
+		return nil, errNoTask("coroutine.resume")
+	}
+	var prev *coroutine
+	if len(t.coroutines) != 0 {
+		prev = t.coroutines[len(t.coroutines)-1]
+	}
+	if co.status == coSuspended {
+		if prev != nil {
+			prev.status = coNormal
+		}
+		t.coroutines = append(t.coroutines, co)
+		defer func() {
+			t.coroutines = t.coroutines[:len(t.coroutines)-1]
+			if prev != nil {
+				prev.status = coRunning
+			}
+		}()
+	}
+	values, _, err := co.resume(args)
+	if err != nil {
+		return nil, err
+	}
+	return newPack(values), nil
+}
+
+func argCoroutine(name string, args []Object, i int) (*coroutine, *EvalError) {
+	if i >= len(args) {
+		return nil, argMissingError(name, i, "coroutine")
+	}
+	if co, ok := args[i].(CoroutineObj); ok {
+		return co.Co.co, nil
+	}
+	return nil, argTypeError(name, i, "coroutine", args[i])
+}
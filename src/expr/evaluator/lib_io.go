@@ -0,0 +1,178 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// WritableFS 是可写的文件系统，路径规则与 fs.FS 相同
+type WritableFS interface {
+	fs.FS
+	WriteFile(name string, data []byte) error
+}
+
+// DirFS 是以某个目录为根的可写文件系统，符号链接也不能指向根目录之外
+type DirFS struct {
+	fs.FS
+	root *os.Root
+}
+
+func NewDirFS(dir string) (*DirFS, error) {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &DirFS{FS: root.FS(), root: root}, nil
+}
+
+func (d *DirFS) WriteFile(name string, data []byte) error {
+	if !fs.ValidPath(name) {
+		return &fs.PathError{Op: "write", Path: name, Err: fs.ErrInvalid}
+	}
+	return d.root.WriteFile(name, data, 0o644)
+}
+
+func (d *DirFS) Close() error {
+	return d.root.Close()
+}
+
+// WithFS 开启只读的 io 模块，脚本只能访问 fsys 中的文件
+func WithFS(fsys fs.FS) Option {
+	return func(in *Interpreter) {
+		in.fs = fsys
+		in.writeFS = nil
+	}
+}
+
+// WithWritableFS 开启可读写的 io 模块
+func WithWritableFS(fsys WritableFS) Option {
+	return func(in *Interpreter) {
+		in.fs = fsys
+		in.writeFS = fsys
+	}
+}
+
+// io 模块只在宿主提供文件系统时可用，路径都相对于文件系统的根
+func newIOLib(in *Interpreter) TableObj {
+	return NewModule("io", map[string]NativeFunc{
+		"readfile":  in.ioReadFile,
+		"writefile": in.ioWriteFile,
+		"listdir":   in.ioListDir,
+		"exists":    in.ioExists,
+		"lines":     in.ioLines,
+	})
+}
+
+// 把脚本中的路径转换为 fs.FS 的路径，拒绝绝对路径和跳出根目录的路径
+func argPath(name string, args []Object, i int) (string, *EvalError) {
+	p, err := argString(name, args, i)
+	if err != nil {
+		return "", err
+	}
+	cleaned := path.Clean(p)
+	if strings.HasPrefix(cleaned, "/") || cleaned == ".." || strings.HasPrefix(cleaned, "../") || !fs.ValidPath(cleaned) {
+		return "", &EvalError{Message: fmt.Sprintf("%s: path %q is outside the root", name, p)}
+	}
+	return cleaned, nil
+}
+
+func ioError(name string, err error) *EvalError {
+	return &EvalError{Message: fmt.Sprintf("%s: %s", name, err.Error())}
+}
+
+func (in *Interpreter) ioReadFile(args []Object) (Object, *EvalError) {
+	p, err := argPath("io.readfile", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	data, e := fs.ReadFile(in.fs, p)
+	if e != nil {
+		return nil, ioError("io.readfile", e)
+	}
+	return StringObj{Value: string(data)}, nil
+}
+
+func (in *Interpreter) ioWriteFile(args []Object) (Object, *EvalError) {
+	if in.writeFS == nil {
+		return nil, &EvalError{Message: "io.writefile: filesystem is read-only"}
+	}
+	p, err := argPath("io.writefile", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	data, err := argString("io.writefile", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if e := in.writeFS.WriteFile(p, []byte(data)); e != nil {
+		return nil, ioError("io.writefile", e)
+	}
+	return NilObj, nil
+}
+
+// io.listdir([path])，返回按名称排序的 pack，目录名以 / 结尾
+func (in *Interpreter) ioListDir(args []Object) (Object, *EvalError) {
+	p := "."
+	if hasArg(args, 0) {
+		var err *EvalError
+		if p, err = argPath("io.listdir", args, 0); err != nil {
+			return nil, err
+		}
+	}
+	entries, e := fs.ReadDir(in.fs, p)
+	if e != nil {
+		return nil, ioError("io.listdir", e)
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name()+"/")
+		} else {
+			names = append(names, entry.Name())
+		}
+	}
+	return stringsToPack(names), nil
+}
+
+func (in *Interpreter) ioExists(args []Object) (Object, *EvalError) {
+	p, err := argPath("io.exists", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	_, e := fs.Stat(in.fs, p)
+	if errors.Is(e, fs.ErrNotExist) {
+		return BooleanObj{Value: false}, nil
+	} else if e != nil {
+		return nil, ioError("io.exists", e)
+	}
+	return BooleanObj{Value: true}, nil
+}
+
+// io.lines(path) 返回迭代函数，每次调用返回下一行（不含换行符），读完后返回 nil
+func (in *Interpreter) ioLines(args []Object) (Object, *EvalError) {
+	p, err := argPath("io.lines", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	data, e := fs.ReadFile(in.fs, p)
+	if e != nil {
+		return nil, ioError("io.lines", e)
+	}
+	rest := string(data)
+	return NewNativeFunc("io.lines", func(args []Object) (Object, *EvalError) {
+		if rest == "" {
+			return NilObj, nil
+		}
+		line := rest
+		if i := strings.IndexByte(rest, '\n'); i >= 0 {
+			line, rest = rest[:i], rest[i+1:]
+		} else {
+			rest = ""
+		}
+		return StringObj{Value: strings.TrimSuffix(line, "\r")}, nil
+	}), nil
+}
@@ -0,0 +1,217 @@
+package evaluator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// json 模块：对象对应 table，数组对应 pack，null 对应 nil
+func newJSONLib() TableObj {
+	return NewModule("json", map[string]NativeFunc{
+		"encode": jsonEncode,
+		"decode": jsonDecode,
+	})
+}
+
+type jsonEncoder struct {
+	buf    bytes.Buffer
+	indent string // 为空时输出紧凑格式
+	// 正在编码的 table/pack，用于检测循环引用
+	visiting map[interface{}]bool
+}
+
+// json.encode(value [, opts])，opts.pretty 为真时缩进输出，opts.indent 指定缩进字符串
+func jsonEncode(args []Object) (Object, *EvalError) {
+	if err := checkNArgs("json.encode", args, 1); err != nil {
+		return nil, err
+	}
+	e := &jsonEncoder{visiting: make(map[interface{}]bool)}
+	if hasArg(args, 1) {
+		opts, err := argTable("json.encode", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		if toBooleanObj(opts.Store[StringObj{Value: "pretty"}]).Value {
+			e.indent = "  "
+		}
+		if indent, ok := opts.Store[StringObj{Value: "indent"}].(StringObj); ok {
+			e.indent = indent.Value
+		}
+	}
+	if err := e.encode(args[0], "$", 0); err != nil {
+		return nil, err
+	}
+	return StringObj{Value: e.buf.String()}, nil
+}
+
+func (e *jsonEncoder) newline(level int) {
+	if e.indent == "" {
+		return
+	}
+	e.buf.WriteByte('\n')
+	e.buf.WriteString(strings.Repeat(e.indent, level))
+}
+
+func (e *jsonEncoder) encodeString(s string) {
+	buf := bytes.Buffer{}
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	e.buf.Write(bytes.TrimRight(buf.Bytes(), "\n"))
+}
+
+func (e *jsonEncoder) encode(obj Object, path string, level int) *EvalError {
+	switch obj := obj.(type) {
+	case NilValue:
+		e.buf.WriteString("null")
+	case BooleanObj:
+		e.buf.WriteString(strconv.FormatBool(obj.Value))
+	case IntegerObj:
+		e.buf.WriteString(strconv.FormatInt(obj.Value, 10))
+	case BigIntObj:
+		e.buf.WriteString(obj.Value.String())
+	case FloatObj:
+		if math.IsNaN(obj.Value) || math.IsInf(obj.Value, 0) {
+			return &EvalError{Message: fmt.Sprintf("json.encode: unsupported number %g at %s", obj.Value, path)}
+		}
+		s := strconv.FormatFloat(obj.Value, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".e") {
+			// 保留小数点，解码时仍得到浮点数
+			s += ".0"
+		}
+		e.buf.WriteString(s)
+	case StringObj:
+		e.encodeString(obj.Value)
+	case PackObj:
+		if e.visiting[obj.Pack] {
+			return &EvalError{Message: fmt.Sprintf("json.encode: cycle detected at %s", path)}
+		}
+		e.visiting[obj.Pack] = true
+		defer delete(e.visiting, obj.Pack)
+		e.buf.WriteByte('[')
+		for i, v := range obj.Pack.Objs {
+			if i != 0 {
+				e.buf.WriteByte(',')
+			}
+			e.newline(level + 1)
+			if err := e.encode(v, fmt.Sprintf("%s[%d]", path, i+1), level+1); err != nil {
+				return err
+			}
+		}
+		if len(obj.Pack.Objs) != 0 {
+			e.newline(level)
+		}
+		e.buf.WriteByte(']')
+	case TableObj:
+		if e.visiting[obj.Table] {
+			return &EvalError{Message: fmt.Sprintf("json.encode: cycle detected at %s", path)}
+		}
+		e.visiting[obj.Table] = true
+		defer delete(e.visiting, obj.Table)
+		keys := make([]string, 0, len(obj.Table.Store))
+		for k := range obj.Table.Store {
+			s, ok := k.(StringObj)
+			if !ok {
+				ks, _ := toString(k)
+				return &EvalError{Message: fmt.Sprintf("json.encode: table key must be string, got %s %s at %s", k.Type(), ks, path)}
+			}
+			keys = append(keys, s.Value)
+		}
+		sort.Strings(keys)
+		e.buf.WriteByte('{')
+		for i, k := range keys {
+			if i != 0 {
+				e.buf.WriteByte(',')
+			}
+			e.newline(level + 1)
+			e.encodeString(k)
+			e.buf.WriteByte(':')
+			if e.indent != "" {
+				e.buf.WriteByte(' ')
+			}
+			if err := e.encode(obj.Table.Store[StringObj{Value: k}], path+"."+k, level+1); err != nil {
+				return err
+			}
+		}
+		if len(keys) != 0 {
+			e.newline(level)
+		}
+		e.buf.WriteByte('}')
+	default:
+		return &EvalError{Message: fmt.Sprintf("json.encode: can't encode %s at %s", obj.Type(), path)}
+	}
+	return nil
+}
+
+// json.decode(s)，整数解码为 integer（超出范围时为大整数），其余数字解码为 float
+func jsonDecode(args []Object) (Object, *EvalError) {
+	s, err := argString("json.decode", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, &EvalError{Message: fmt.Sprintf("json.decode: %s", err.Error())}
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, &EvalError{Message: "json.decode: invalid data after top-level value"}
+	}
+	return fromJSONValue(v)
+}
+
+func fromJSONValue(v interface{}) (Object, *EvalError) {
+	switch v := v.(type) {
+	case nil:
+		return NilObj, nil
+	case bool:
+		return BooleanObj{Value: v}, nil
+	case string:
+		return StringObj{Value: v}, nil
+	case json.Number:
+		s := v.String()
+		if !strings.ContainsAny(s, ".eE") {
+			if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return IntegerObj{Value: n}, nil
+			}
+			if n, ok := new(big.Int).SetString(s, 10); ok {
+				return BigIntObj{Value: n}, nil
+			}
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, &EvalError{Message: fmt.Sprintf("json.decode: invalid number %s", s)}
+		}
+		return FloatObj{Value: f}, nil
+	case []interface{}:
+		objs := make([]Object, 0, len(v))
+		for _, item := range v {
+			obj, err := fromJSONValue(item)
+			if err != nil {
+				return nil, err
+			}
+			objs = append(objs, obj)
+		}
+		return newPack(objs), nil
+	case map[string]interface{}:
+		table := newTable()
+		for k, item := range v {
+			obj, err := fromJSONValue(item)
+			if err != nil {
+				return nil, err
+			}
+			table.Table.Store[StringObj{Value: k}] = obj
+		}
+		return table, nil
+	default:
+		return nil, &EvalError{Message: fmt.Sprintf("json.decode: unexpected value %v", v)}
+	}
+}
@@ -0,0 +1,284 @@
+package evaluator
+
+import (
+	"expr/lexer"
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// math 模块，random 使用解释器自己的随机数生成器
+func newMathLib(in *Interpreter) TableObj {
+	module := NewModule("math", map[string]NativeFunc{
+		"abs":        mathAbs,
+		"floor":      mathRounding("math.floor", math.Floor),
+		"ceil":       mathRounding("math.ceil", math.Ceil),
+		"round":      mathRounding("math.round", math.Round),
+		"trunc":      mathRounding("math.trunc", math.Trunc),
+		"sqrt":       mathFloat1("math.sqrt", math.Sqrt),
+		"exp":        mathFloat1("math.exp", math.Exp),
+		"sin":        mathFloat1("math.sin", math.Sin),
+		"cos":        mathFloat1("math.cos", math.Cos),
+		"tan":        mathFloat1("math.tan", math.Tan),
+		"asin":       mathFloat1("math.asin", math.Asin),
+		"acos":       mathFloat1("math.acos", math.Acos),
+		"atan":       mathAtan,
+		"pow":        mathPow,
+		"log":        mathLog,
+		"min":        mathMinMax(in, "math.min", lexer.T_LT),
+		"max":        mathMinMax(in, "math.max", lexer.T_GT),
+		"isnan":      mathIsNaN,
+		"isinf":      mathIsInf,
+		"toint":      mathToInt,
+		"tofloat":    mathToFloat,
+		"random":     in.mathRandom,
+		"randomseed": in.mathRandomSeed,
+	})
+	module.Table.Store[StringObj{Value: "pi"}] = FloatObj{Value: math.Pi}
+	module.Table.Store[StringObj{Value: "e"}] = FloatObj{Value: math.E}
+	module.Table.Store[StringObj{Value: "inf"}] = FloatObj{Value: math.Inf(1)}
+	module.Table.Store[StringObj{Value: "nan"}] = FloatObj{Value: math.NaN()}
+	module.Table.Store[StringObj{Value: "maxint"}] = IntegerObj{Value: math.MaxInt64}
+	module.Table.Store[StringObj{Value: "minint"}] = IntegerObj{Value: math.MinInt64}
+	return module
+}
+
+// WithRandSeed 固定 math.random 的种子，使运行结果可以复现
+func WithRandSeed(seed int64) Option {
+	return func(in *Interpreter) {
+		in.rand = rand.New(rand.NewSource(seed))
+	}
+}
+
+func mathAbs(args []Object) (Object, *EvalError) {
+	if err := checkNArgs("math.abs", args, 1); err != nil {
+		return nil, err
+	}
+	switch obj := args[0].(type) {
+	case IntegerObj:
+		if obj.Value < 0 {
+			return checkedNeg(obj.Value), nil
+		}
+		return obj, nil
+	case BigIntObj:
+		return normalizeBigInt(new(big.Int).Abs(obj.Value)), nil
+	case FloatObj:
+		return FloatObj{Value: math.Abs(obj.Value)}, nil
+	default:
+		return nil, argTypeError("math.abs", 0, "number", obj)
+	}
+}
+
+// 浮点数转换为整数，超出 int64 范围时转换为大整数
+func floatToInteger(name string, f float64) (Object, *EvalError) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, &EvalError{Message: fmt.Sprintf("%s: can't convert %g to integer", name, f)}
+	}
+	if f >= -(1<<63) && f < 1<<63 {
+		return IntegerObj{Value: int64(f)}, nil
+	}
+	v, _ := big.NewFloat(f).Int(nil)
+	return BigIntObj{Value: v}, nil
+}
+
+// floor/ceil/round/trunc 对整数不做处理，浮点数取整后返回整数
+func mathRounding(name string, fn func(float64) float64) NativeFunc {
+	return func(args []Object) (Object, *EvalError) {
+		if err := checkNArgs(name, args, 1); err != nil {
+			return nil, err
+		}
+		switch obj := args[0].(type) {
+		case IntegerObj, BigIntObj:
+			return obj, nil
+		case FloatObj:
+			return floatToInteger(name, fn(obj.Value))
+		default:
+			return nil, argTypeError(name, 0, "number", obj)
+		}
+	}
+}
+
+func mathFloat1(name string, fn func(float64) float64) NativeFunc {
+	return func(args []Object) (Object, *EvalError) {
+		x, err := argNumber(name, args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return FloatObj{Value: fn(x)}, nil
+	}
+}
+
+// math.atan(y [, x])
+func mathAtan(args []Object) (Object, *EvalError) {
+	y, err := argNumber("math.atan", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if !hasArg(args, 1) {
+		return FloatObj{Value: math.Atan(y)}, nil
+	}
+	x, err := argNumber("math.atan", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return FloatObj{Value: math.Atan2(y, x)}, nil
+}
+
+func mathPow(args []Object) (Object, *EvalError) {
+	x, err := argNumber("math.pow", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	y, err := argNumber("math.pow", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return FloatObj{Value: math.Pow(x, y)}, nil
+}
+
+// math.log(x [, base])，默认为自然对数
+func mathLog(args []Object) (Object, *EvalError) {
+	x, err := argNumber("math.log", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if !hasArg(args, 1) {
+		return FloatObj{Value: math.Log(x)}, nil
+	}
+	base, err := argNumber("math.log", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	switch base {
+	case 2:
+		return FloatObj{Value: math.Log2(x)}, nil
+	case 10:
+		return FloatObj{Value: math.Log10(x)}, nil
+	}
+	return FloatObj{Value: math.Log(x) / math.Log(base)}, nil
+}
+
+// min/max 使用脚本中的比较运算，因此也支持带 __lt 元方法的表
+func mathMinMax(in *Interpreter, name string, op lexer.TokenType) NativeFunc {
+	return func(args []Object) (Object, *EvalError) {
+		if err := checkNArgs(name, args, 1); err != nil {
+			return nil, err
+		}
+		res := args[0]
+		for _, arg := range args[1:] {
+			better, err := evalInfixOperator(in, op, arg, res)
+			if err != nil {
+				return nil, err
+			}
+			if toBooleanObj(better).Value {
+				res = arg
+			}
+		}
+		return res, nil
+	}
+}
+
+func mathIsNaN(args []Object) (Object, *EvalError) {
+	if err := checkNArgs("math.isnan", args, 1); err != nil {
+		return nil, err
+	}
+	f, ok := args[0].(FloatObj)
+	return BooleanObj{Value: ok && math.IsNaN(f.Value)}, nil
+}
+
+func mathIsInf(args []Object) (Object, *EvalError) {
+	if err := checkNArgs("math.isinf", args, 1); err != nil {
+		return nil, err
+	}
+	f, ok := args[0].(FloatObj)
+	return BooleanObj{Value: ok && math.IsInf(f.Value, 0)}, nil
+}
+
+// math.toint(x)，浮点数向零取整，字符串按整数字面量解析，无法转换的字符串返回 nil
+func mathToInt(args []Object) (Object, *EvalError) {
+	if err := checkNArgs("math.toint", args, 1); err != nil {
+		return nil, err
+	}
+	switch obj := args[0].(type) {
+	case IntegerObj, BigIntObj:
+		return obj, nil
+	case FloatObj:
+		return floatToInteger("math.toint", math.Trunc(obj.Value))
+	case StringObj:
+		s := strings.TrimSpace(obj.Value)
+		if v, err := strconv.ParseInt(s, 0, 64); err == nil {
+			return IntegerObj{Value: v}, nil
+		}
+		if v, ok := new(big.Int).SetString(s, 0); ok {
+			return normalizeBigInt(v), nil
+		}
+		return NilObj, nil
+	default:
+		return nil, argTypeError("math.toint", 0, "number or string", obj)
+	}
+}
+
+// math.tofloat(x)，无法转换的字符串返回 nil
+func mathToFloat(args []Object) (Object, *EvalError) {
+	if err := checkNArgs("math.tofloat", args, 1); err != nil {
+		return nil, err
+	}
+	switch obj := args[0].(type) {
+	case IntegerObj, BigIntObj, FloatObj:
+		return toFloatObj(obj), nil
+	case StringObj:
+		if v, err := strconv.ParseFloat(strings.TrimSpace(obj.Value), 64); err == nil {
+			return FloatObj{Value: v}, nil
+		}
+		return NilObj, nil
+	default:
+		return nil, argTypeError("math.tofloat", 0, "number or string", obj)
+	}
+}
+
+// math.random() 返回 [0, 1) 的浮点数，math.random(n) 返回 [1, n] 的整数，
+// math.random(m, n) 返回 [m, n] 的整数
+func (in *Interpreter) mathRandom(args []Object) (Object, *EvalError) {
+	if len(args) == 0 {
+		return FloatObj{Value: in.rand.Float64()}, nil
+	}
+	low, high := int64(1), int64(0)
+	var err *EvalError
+	if len(args) == 1 {
+		high, err = argInteger("math.random", args, 0)
+	} else {
+		if low, err = argInteger("math.random", args, 0); err != nil {
+			return nil, err
+		}
+		high, err = argInteger("math.random", args, 1)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if low > high {
+		return nil, &EvalError{Message: fmt.Sprintf("math.random: interval is empty [%d, %d]", low, high)}
+	}
+	n := uint64(high - low)
+	if n == math.MaxUint64 {
+		return IntegerObj{Value: int64(in.rand.Uint64())}, nil
+	}
+	var r uint64
+	if n < math.MaxInt64 {
+		r = uint64(in.rand.Int63n(int64(n + 1)))
+	} else {
+		r = in.rand.Uint64() % (n + 1)
+	}
+	return IntegerObj{Value: low + int64(r)}, nil
+}
+
+func (in *Interpreter) mathRandomSeed(args []Object) (Object, *EvalError) {
+	seed, err := argInteger("math.randomseed", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	in.rand.Seed(seed)
+	return NilObj, nil
+}
@@ -0,0 +1,256 @@
+package evaluator
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// 每个解释器最多缓存的正则表达式数量，超出后清空缓存
+const maxRegexpCache = 256
+
+// regexpLib 是每个解释器独有的 re 模块，缓存编译结果。
+// re.compile 返回 table{ pattern = "..." }，元表的 __index 指向模块函数，
+// 因此 re.find(r, s)、re.find("pattern", s) 与 r:find(s) 等价
+type regexpLib struct {
+	in    *Interpreter
+	cache map[string]*regexp.Regexp
+	meta  *TableValue
+}
+
+func newRegexpLib(in *Interpreter) TableObj {
+	lib := &regexpLib{in: in, cache: make(map[string]*regexp.Regexp)}
+	module := NewModule("re", map[string]NativeFunc{
+		"compile": lib.compile,
+		"match":   lib.match,
+		"find":    lib.find,
+		"findall": lib.findAll,
+		"replace": lib.replace,
+		"split":   lib.split,
+		"escape":  regexpEscape,
+	})
+	lib.meta = &TableValue{Store: map[Object]Object{
+		StringObj{Value: "__index"}:    module,
+		StringObj{Value: "__tostring"}: NewNativeFunc("re.tostring", lib.toString),
+	}}
+	return module
+}
+
+func (lib *regexpLib) get(name string, pattern string) (*regexp.Regexp, *EvalError) {
+	if re, ok := lib.cache[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, &EvalError{Message: fmt.Sprintf("%s: %s", name, err.Error())}
+	}
+	if len(lib.cache) >= maxRegexpCache {
+		lib.cache = make(map[string]*regexp.Regexp)
+	}
+	lib.cache[pattern] = re
+	return re, nil
+}
+
+// 参数可以是模式字符串或 re.compile 的返回值
+func (lib *regexpLib) argRegexp(name string, args []Object, i int) (*regexp.Regexp, *EvalError) {
+	if i >= len(args) {
+		return nil, argMissingError(name, i, "pattern")
+	}
+	switch arg := args[i].(type) {
+	case StringObj:
+		return lib.get(name, arg.Value)
+	case TableObj:
+		if pattern, ok := arg.Table.Store[StringObj{Value: "pattern"}].(StringObj); ok && arg.Table.Meta == lib.meta {
+			return lib.get(name, pattern.Value)
+		}
+	}
+	return nil, argTypeError(name, i, "pattern", args[i])
+}
+
+func (lib *regexpLib) compile(args []Object) (Object, *EvalError) {
+	pattern, err := argString("re.compile", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := lib.get("re.compile", pattern); err != nil {
+		return nil, err
+	}
+	return TableObj{Table: &TableValue{
+		Store: map[Object]Object{StringObj{Value: "pattern"}: StringObj{Value: pattern}},
+		Meta:  lib.meta,
+	}}, nil
+}
+
+func (lib *regexpLib) toString(args []Object) (Object, *EvalError) {
+	re, err := lib.argRegexp("re.tostring", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return StringObj{Value: fmt.Sprintf("regexp: %s", re.String())}, nil
+}
+
+// re.match(p, s)，s 中存在匹配时返回 true
+func (lib *regexpLib) match(args []Object) (Object, *EvalError) {
+	re, err := lib.argRegexp("re.match", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	s, err := argString("re.match", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return BooleanObj{Value: re.MatchString(s)}, nil
+}
+
+// 有命名分组时返回 table，键为分组名以及从 0 开始的分组序号；
+// 否则返回 pack [整个匹配, 分组1, 分组2, ...]。未参与匹配的分组为 nil
+func matchResult(re *regexp.Regexp, s string, loc []int) Object {
+	groups := make([]Object, 0, len(loc)/2)
+	for i := 0; i < len(loc); i += 2 {
+		if loc[i] < 0 {
+			groups = append(groups, NilObj)
+		} else {
+			groups = append(groups, StringObj{Value: s[loc[i]:loc[i+1]]})
+		}
+	}
+	if !hasNamedGroup(re) {
+		return newPack(groups)
+	}
+	table := newTable()
+	for i, name := range re.SubexpNames() {
+		table.Table.Store[IntegerObj{Value: int64(i)}] = groups[i]
+		if name != "" {
+			table.Table.Store[StringObj{Value: name}] = groups[i]
+		}
+	}
+	return table
+}
+
+func hasNamedGroup(re *regexp.Regexp) bool {
+	for _, name := range re.SubexpNames() {
+		if name != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// re.find(p, s)，返回第一个匹配，没有匹配时返回 nil
+func (lib *regexpLib) find(args []Object) (Object, *EvalError) {
+	re, err := lib.argRegexp("re.find", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	s, err := argString("re.find", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	loc := re.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return NilObj, nil
+	}
+	return matchResult(re, s, loc), nil
+}
+
+// re.findall(p, s [, n])，返回所有匹配组成的 pack；
+// 没有分组时每个元素是匹配的字符串，否则与 re.find 的返回值相同
+func (lib *regexpLib) findAll(args []Object) (Object, *EvalError) {
+	re, err := lib.argRegexp("re.findall", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	s, err := argString("re.findall", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	n := int64(-1)
+	if hasArg(args, 2) {
+		if n, err = argInteger("re.findall", args, 2); err != nil {
+			return nil, err
+		}
+	}
+	res := make([]Object, 0)
+	for _, loc := range re.FindAllStringSubmatchIndex(s, int(n)) {
+		if re.NumSubexp() == 0 {
+			res = append(res, StringObj{Value: s[loc[0]:loc[1]]})
+		} else {
+			res = append(res, matchResult(re, s, loc))
+		}
+	}
+	return newPack(res), nil
+}
+
+// re.replace(p, s, repl)，repl 为字符串时按模板展开，支持 $1、${name}；
+// repl 为函数时以 (整个匹配, 分组1, ...) 调用，返回值经 tostring 转换后作为替换结果
+func (lib *regexpLib) replace(args []Object) (Object, *EvalError) {
+	re, err := lib.argRegexp("re.replace", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	s, err := argString("re.replace", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNArgs("re.replace", args, 3); err != nil {
+		return nil, err
+	}
+	if template, ok := args[2].(StringObj); ok {
+		return StringObj{Value: re.ReplaceAllString(s, template.Value)}, nil
+	}
+	fn, err := argCallable("re.replace", args, 2)
+	if err != nil {
+		return nil, argTypeError("re.replace", 2, "string or function", args[2])
+	}
+	buf := make([]byte, 0, len(s))
+	last := 0
+	for _, loc := range re.FindAllStringSubmatchIndex(s, -1) {
+		groups := matchResult(re, s, loc)
+		var callArgs []Object
+		if pack, ok := groups.(PackObj); ok {
+			callArgs = pack.Pack.Objs
+		} else {
+			for i := 0; i <= re.NumSubexp(); i++ {
+				callArgs = append(callArgs, groups.(TableObj).Table.Store[IntegerObj{Value: int64(i)}])
+			}
+		}
+		res, err := callFunction(lib.in, fn, callArgs)
+		if err != nil {
+			return nil, err
+		}
+		str, err := toString(res)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, s[last:loc[0]]...)
+		buf = append(buf, str...)
+		last = loc[1]
+	}
+	buf = append(buf, s[last:]...)
+	return StringObj{Value: string(buf)}, nil
+}
+
+// re.split(p, s [, n])
+func (lib *regexpLib) split(args []Object) (Object, *EvalError) {
+	re, err := lib.argRegexp("re.split", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	s, err := argString("re.split", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	n := int64(-1)
+	if hasArg(args, 2) {
+		if n, err = argInteger("re.split", args, 2); err != nil {
+			return nil, err
+		}
+	}
+	return stringsToPack(re.Split(s, int(n))), nil
+}
+
+func regexpEscape(args []Object) (Object, *EvalError) {
+	s, err := argString("re.escape", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return StringObj{Value: regexp.QuoteMeta(s)}, nil
+}
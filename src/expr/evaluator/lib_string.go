@@ -0,0 +1,316 @@
+package evaluator
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// string 模块，下标以 rune 计数，从 1 开始，负数表示从末尾倒数
+func newStringLib() TableObj {
+	return NewModule("string", map[string]NativeFunc{
+		"split":      stringSplit,
+		"join":       stringJoin,
+		"trim":       stringTrim,
+		"upper":      stringUpper,
+		"lower":      stringLower,
+		"replace":    stringReplace,
+		"find":       stringFind,
+		"startswith": stringStartsWith,
+		"endswith":   stringEndsWith,
+		"repeat":     stringRepeat,
+		"format":     stringFormat,
+		"sub":        stringSub,
+	})
+}
+
+func stringsToPack(ss []string) PackObj {
+	pack := &PackValue{Objs: make([]Object, 0, len(ss))}
+	for _, s := range ss {
+		pack.Objs = append(pack.Objs, StringObj{Value: s})
+	}
+	return PackObj{Pack: pack}
+}
+
+// string.split(s, sep)，sep 为空串时按字符拆分
+func stringSplit(args []Object) (Object, *EvalError) {
+	s, err := argString("string.split", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	sep, err := argString("string.split", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return stringsToPack(strings.Split(s, sep)), nil
+}
+
+// string.join(pack, sep)，元素按 tostring 转换
+func stringJoin(args []Object) (Object, *EvalError) {
+	pack, err := argPack("string.join", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	sep := ""
+	if hasArg(args, 1) {
+		if sep, err = argString("string.join", args, 1); err != nil {
+			return nil, err
+		}
+	}
+	ss := make([]string, 0, len(pack.Objs))
+	for _, obj := range pack.Objs {
+		s, err := toString(obj)
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, s)
+	}
+	return StringObj{Value: strings.Join(ss, sep)}, nil
+}
+
+// string.trim(s [, cutset])，默认去掉首尾空白
+func stringTrim(args []Object) (Object, *EvalError) {
+	s, err := argString("string.trim", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if hasArg(args, 1) {
+		cutset, err := argString("string.trim", args, 1)
+		if err != nil {
+			return nil, err
+		}
+		return StringObj{Value: strings.Trim(s, cutset)}, nil
+	}
+	return StringObj{Value: strings.TrimSpace(s)}, nil
+}
+
+func stringUpper(args []Object) (Object, *EvalError) {
+	s, err := argString("string.upper", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return StringObj{Value: strings.ToUpper(s)}, nil
+}
+
+func stringLower(args []Object) (Object, *EvalError) {
+	s, err := argString("string.lower", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return StringObj{Value: strings.ToLower(s)}, nil
+}
+
+// string.replace(s, old, new [, n])，默认替换全部
+func stringReplace(args []Object) (Object, *EvalError) {
+	s, err := argString("string.replace", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	old, err := argString("string.replace", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	replacement, err := argString("string.replace", args, 2)
+	if err != nil {
+		return nil, err
+	}
+	n := int64(-1)
+	if hasArg(args, 3) {
+		if n, err = argInteger("string.replace", args, 3); err != nil {
+			return nil, err
+		}
+	}
+	return StringObj{Value: strings.Replace(s, old, replacement, int(n))}, nil
+}
+
+// string.find(s, sub [, start])，返回首次出现的位置，找不到返回 nil
+func stringFind(args []Object) (Object, *EvalError) {
+	s, err := argString("string.find", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	sub, err := argString("string.find", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	runes := []rune(s)
+	start := int64(1)
+	if hasArg(args, 2) {
+		if start, err = argInteger("string.find", args, 2); err != nil {
+			return nil, err
+		}
+		start = normalizeStringIndex(start, len(runes))
+	}
+	if start > int64(len(runes))+1 {
+		return NilObj, nil
+	}
+	prefix := string(runes[:start-1])
+	i := strings.Index(s[len(prefix):], sub)
+	if i < 0 {
+		return NilObj, nil
+	}
+	return IntegerObj{Value: start + int64(utf8.RuneCountInString(s[len(prefix):len(prefix)+i]))}, nil
+}
+
+func stringStartsWith(args []Object) (Object, *EvalError) {
+	s, err := argString("string.startswith", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := argString("string.startswith", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return BooleanObj{Value: strings.HasPrefix(s, prefix)}, nil
+}
+
+func stringEndsWith(args []Object) (Object, *EvalError) {
+	s, err := argString("string.endswith", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	suffix, err := argString("string.endswith", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return BooleanObj{Value: strings.HasSuffix(s, suffix)}, nil
+}
+
+// string.repeat 结果的最大字节数
+const maxRepeatLength = 1 << 28
+
+// string.repeat(s, n [, sep])
+func stringRepeat(args []Object) (Object, *EvalError) {
+	s, err := argString("string.repeat", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	n, err := argInteger("string.repeat", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, &EvalError{Message: fmt.Sprintf("string.repeat: negative count %d", n)}
+	}
+	sep := ""
+	if hasArg(args, 2) {
+		if sep, err = argString("string.repeat", args, 2); err != nil {
+			return nil, err
+		}
+	}
+	if n == 0 {
+		return StringObj{Value: ""}, nil
+	}
+	unit := int64(len(s) + len(sep))
+	if unit > 0 && (n-1 > maxRepeatLength/unit || (n-1)*unit+int64(len(s)) > maxRepeatLength) {
+		return nil, &EvalError{Message: fmt.Sprintf("string.repeat: result too large, count %d", n)}
+	}
+	return StringObj{Value: strings.Repeat(s+sep, int(n-1)) + s}, nil
+}
+
+// 把 1 开始、可为负数的下标转换为 [1, length+1] 内的下标
+func normalizeStringIndex(i int64, length int) int64 {
+	if i < 0 {
+		i = int64(length) + i + 1
+	}
+	if i < 1 {
+		i = 1
+	}
+	return i
+}
+
+// string.sub(s, i [, j])，返回第 i 到第 j 个字符（包含两端）
+func stringSub(args []Object) (Object, *EvalError) {
+	s, err := argString("string.sub", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	i, err := argInteger("string.sub", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	runes := []rune(s)
+	j := int64(len(runes))
+	if hasArg(args, 2) {
+		if j, err = argInteger("string.sub", args, 2); err != nil {
+			return nil, err
+		}
+		if j < 0 {
+			j = int64(len(runes)) + j + 1
+		}
+	}
+	i = normalizeStringIndex(i, len(runes))
+	if j > int64(len(runes)) {
+		j = int64(len(runes))
+	}
+	if i > j {
+		return StringObj{Value: ""}, nil
+	}
+	return StringObj{Value: string(runes[i-1 : j])}, nil
+}
+
+// string.format(fmt, args...)，支持 printf 风格的 %d %x %o %b %c %f %e %g %s %q %v %t %%
+// 以及标志、宽度和精度，%s %v 按 tostring 转换
+func stringFormat(args []Object) (Object, *EvalError) {
+	format, err := argString("string.format", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.Buffer{}
+	argIndex := 1
+	for i := 0; i < len(format); i++ {
+		c := format[i]
+		if c != '%' {
+			buf.WriteByte(c)
+			continue
+		}
+		j := i + 1
+		for j < len(format) && strings.IndexByte("+-# 0123456789.", format[j]) >= 0 {
+			j++
+		}
+		if j >= len(format) {
+			return nil, &EvalError{Message: fmt.Sprintf("string.format: incomplete verb %q", format[i:])}
+		}
+		spec, verb := format[i:j+1], format[j]
+		i = j
+		if verb == '%' {
+			buf.WriteByte('%')
+			continue
+		}
+		if argIndex >= len(args) {
+			return nil, &EvalError{Message: fmt.Sprintf("string.format: missing argument for %s", spec)}
+		}
+		value, err := formatValue(verb, args[argIndex], argIndex)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString(fmt.Sprintf(spec, value))
+		argIndex++
+	}
+	return StringObj{Value: buf.String()}, nil
+}
+
+func formatValue(verb byte, arg Object, i int) (interface{}, *EvalError) {
+	switch verb {
+	case 'd', 'x', 'X', 'o', 'b', 'c':
+		switch arg := arg.(type) {
+		case IntegerObj:
+			return arg.Value, nil
+		case BigIntObj:
+			return arg.Value, nil
+		}
+		return nil, argTypeError("string.format", i, "integer for %"+string(verb), arg)
+	case 'f', 'F', 'e', 'E', 'g', 'G':
+		if isNumberObj(arg) {
+			return toFloatObj(arg).Value, nil
+		}
+		return nil, argTypeError("string.format", i, "number for %"+string(verb), arg)
+	case 't':
+		return toBooleanObj(arg).Value, nil
+	case 's', 'v', 'q':
+		return toString(arg)
+	default:
+		return nil, &EvalError{Message: fmt.Sprintf("string.format: unknown verb %%%c", verb)}
+	}
+}
@@ -0,0 +1,492 @@
+package evaluator
+
+import (
+	"expr/lexer"
+	"math"
+	"math/big"
+	"sort"
+)
+
+// pack 模块，回调函数的参数为 (value, index)，下标从 1 开始；所有函数都返回新的 pack
+func newPackLib(in *Interpreter) TableObj {
+	return NewModule("pack", map[string]NativeFunc{
+		"map":      in.packMap,
+		"filter":   in.packFilter,
+		"reduce":   in.packReduce,
+		"sort":     in.packSort,
+		"keys":     packKeys,
+		"values":   packValues,
+		"contains": in.packContains,
+		"reverse":  packReverse,
+		"unique":   packUnique,
+		"zip":      packZip,
+		"flatten":  packFlatten,
+	})
+}
+
+// table 模块，回调函数的参数为 (value, key)，按 sortedKeys 的顺序遍历
+func newTableLib(in *Interpreter) TableObj {
+	return NewModule("table", map[string]NativeFunc{
+		"map":      in.tableMap,
+		"filter":   in.tableFilter,
+		"reduce":   in.tableReduce,
+		"keys":     tableKeys,
+		"values":   tableValues,
+		"contains": in.tableContains,
+	})
+}
+
+func newPack(objs []Object) PackObj {
+	return PackObj{Pack: &PackValue{Objs: objs}}
+}
+
+func newTable() TableObj {
+	return TableObj{Table: &TableValue{Store: make(map[Object]Object)}}
+}
+
+func argCallable(name string, args []Object, i int) (Object, *EvalError) {
+	if i >= len(args) {
+		return nil, argMissingError(name, i, "function")
+	}
+	if !isCallable(args[i]) {
+		return nil, argTypeError(name, i, "function", args[i])
+	}
+	return args[i], nil
+}
+
+func keyTypeRank(key Object) int {
+	switch key.(type) {
+	case IntegerObj, FloatObj:
+		return 0
+	case StringObj:
+		return 1
+	case BooleanObj:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// sortedKeys 返回确定顺序的键：数字按大小，其次字符串、布尔值，
+// 最后是其他对象，先按类型，同类型按插入顺序
+func sortedKeys(table *TableValue) []Object {
+	keys := make([]Object, 0, len(table.Store))
+	for k := range table.Store {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if ra, rb := keyTypeRank(a), keyTypeRank(b); ra != rb {
+			return ra < rb
+		}
+		switch a := a.(type) {
+		case IntegerObj:
+			if b, ok := b.(IntegerObj); ok {
+				return a.Value < b.Value
+			}
+			return float64(a.Value) < toFloatObj(b).Value
+		case FloatObj:
+			return a.Value < toFloatObj(b).Value
+		case StringObj:
+			return a.Value < b.(StringObj).Value
+		case BooleanObj:
+			return !a.Value && b.(BooleanObj).Value
+		default:
+			if a.Type() != b.Type() {
+				return a.Type() < b.Type()
+			}
+			return table.seq[a] < table.seq[b]
+		}
+	})
+	return keys
+}
+
+// 不同类型的非数字对象不相等，其余按 == 运算比较
+func equalObj(in *Interpreter, a Object, b Object) (bool, *EvalError) {
+	if a.Type() != b.Type() && !(isNumberObj(a) && isNumberObj(b)) {
+		return false, nil
+	}
+	res, err := evalInfixOperator(in, lexer.T_EQ, a, b)
+	if err != nil {
+		return false, err
+	}
+	return toBooleanObj(res).Value, nil
+}
+
+func (in *Interpreter) packMap(args []Object) (Object, *EvalError) {
+	pack, err := argPack("pack.map", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	fn, err := argCallable("pack.map", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Object, 0, len(pack.Objs))
+	for i, v := range pack.Objs {
+		obj, err := callFunction(in, fn, []Object{v, IntegerObj{Value: int64(i + 1)}})
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, obj)
+	}
+	return newPack(res), nil
+}
+
+func (in *Interpreter) packFilter(args []Object) (Object, *EvalError) {
+	pack, err := argPack("pack.filter", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	fn, err := argCallable("pack.filter", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Object, 0)
+	for i, v := range pack.Objs {
+		keep, err := callFunction(in, fn, []Object{v, IntegerObj{Value: int64(i + 1)}})
+		if err != nil {
+			return nil, err
+		}
+		if toBooleanObj(keep).Value {
+			res = append(res, v)
+		}
+	}
+	return newPack(res), nil
+}
+
+// pack.reduce(p, fn(acc, value, index) [, init])，没有初始值时以第一个元素为初始值
+func (in *Interpreter) packReduce(args []Object) (Object, *EvalError) {
+	pack, err := argPack("pack.reduce", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	fn, err := argCallable("pack.reduce", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	objs := pack.Objs
+	start := 0
+	var acc Object
+	if len(args) > 2 {
+		acc = args[2]
+	} else {
+		if len(objs) == 0 {
+			return nil, &EvalError{Message: "pack.reduce: empty pack with no initial value"}
+		}
+		acc = objs[0]
+		start = 1
+	}
+	for i := start; i < len(objs); i++ {
+		if acc, err = callFunction(in, fn, []Object{acc, objs[i], IntegerObj{Value: int64(i + 1)}}); err != nil {
+			return nil, err
+		}
+	}
+	return acc, nil
+}
+
+// 默认比较：字符串按字典序，其余使用 < 运算
+func lessObj(in *Interpreter, a Object, b Object) (bool, *EvalError) {
+	if sa, ok := a.(StringObj); ok {
+		if sb, ok := b.(StringObj); ok {
+			return sa.Value < sb.Value, nil
+		}
+	}
+	res, err := evalInfixOperator(in, lexer.T_LT, a, b)
+	if err != nil {
+		return false, err
+	}
+	return toBooleanObj(res).Value, nil
+}
+
+// pack.sort(p [, less])，less(a, b) 为真表示 a 排在 b 之前；排序是稳定的
+func (in *Interpreter) packSort(args []Object) (Object, *EvalError) {
+	pack, err := argPack("pack.sort", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	var less Object
+	if hasArg(args, 1) {
+		if less, err = argCallable("pack.sort", args, 1); err != nil {
+			return nil, err
+		}
+	}
+	res := append([]Object(nil), pack.Objs...)
+	var sortErr *EvalError
+	sort.SliceStable(res, func(i, j int) bool {
+		if sortErr != nil {
+			return false
+		}
+		if less == nil {
+			var ok bool
+			ok, sortErr = lessObj(in, res[i], res[j])
+			return ok
+		}
+		var obj Object
+		obj, sortErr = callFunction(in, less, []Object{res[i], res[j]})
+		return sortErr == nil && toBooleanObj(obj).Value
+	})
+	if sortErr != nil {
+		return nil, sortErr
+	}
+	return newPack(res), nil
+}
+
+func packKeys(args []Object) (Object, *EvalError) {
+	pack, err := argPack("pack.keys", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]Object, 0, len(pack.Objs))
+	for i := range pack.Objs {
+		res = append(res, IntegerObj{Value: int64(i + 1)})
+	}
+	return newPack(res), nil
+}
+
+func packValues(args []Object) (Object, *EvalError) {
+	pack, err := argPack("pack.values", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return newPack(append([]Object(nil), pack.Objs...)), nil
+}
+
+func containsObj(in *Interpreter, objs []Object, value Object) (bool, *EvalError) {
+	for _, obj := range objs {
+		eq, err := equalObj(in, obj, value)
+		if err != nil {
+			return false, err
+		}
+		if eq {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (in *Interpreter) packContains(args []Object) (Object, *EvalError) {
+	pack, err := argPack("pack.contains", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNArgs("pack.contains", args, 2); err != nil {
+		return nil, err
+	}
+	ok, err := containsObj(in, pack.Objs, args[1])
+	if err != nil {
+		return nil, err
+	}
+	return BooleanObj{Value: ok}, nil
+}
+
+func packReverse(args []Object) (Object, *EvalError) {
+	pack, err := argPack("pack.reverse", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	n := len(pack.Objs)
+	res := make([]Object, n)
+	for i, v := range pack.Objs {
+		res[n-1-i] = v
+	}
+	return newPack(res), nil
+}
+
+// 大整数按值去重
+type bigIntKey string
+
+// 返回按 == 去重时使用的键：整数值的浮点数与相等的整数、大整数使用同一个键
+func uniqueKey(v Object) interface{} {
+	switch v := v.(type) {
+	case BigIntObj:
+		return bigIntKey(v.Value.String())
+	case FloatObj:
+		f := v.Value
+		if math.IsInf(f, 0) || f != math.Trunc(f) {
+			return v
+		}
+		if f >= math.MinInt64 && f < math.MaxInt64 {
+			return IntegerObj{Value: int64(f)}
+		}
+		i, _ := big.NewFloat(f).Int(nil)
+		return bigIntKey(i.String())
+	}
+	return v
+}
+
+func packUnique(args []Object) (Object, *EvalError) {
+	pack, err := argPack("pack.unique", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[interface{}]bool)
+	res := make([]Object, 0)
+	for _, v := range pack.Objs {
+		key := uniqueKey(v)
+		if !seen[key] {
+			seen[key] = true
+			res = append(res, v)
+		}
+	}
+	return newPack(res), nil
+}
+
+// pack.zip(a, b, ...)，长度取最短的 pack
+func packZip(args []Object) (Object, *EvalError) {
+	if err := checkNArgs("pack.zip", args, 1); err != nil {
+		return nil, err
+	}
+	packs := make([]*PackValue, 0, len(args))
+	n := -1
+	for i := range args {
+		pack, err := argPack("pack.zip", args, i)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 || len(pack.Objs) < n {
+			n = len(pack.Objs)
+		}
+		packs = append(packs, pack)
+	}
+	res := make([]Object, 0, n)
+	for i := 0; i < n; i++ {
+		tuple := make([]Object, 0, len(packs))
+		for _, pack := range packs {
+			tuple = append(tuple, pack.Objs[i])
+		}
+		res = append(res, newPack(tuple))
+	}
+	return newPack(res), nil
+}
+
+// pack.flatten(p [, depth])，默认只展开一层
+func packFlatten(args []Object) (Object, *EvalError) {
+	pack, err := argPack("pack.flatten", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	depth := int64(1)
+	if hasArg(args, 1) {
+		if depth, err = argInteger("pack.flatten", args, 1); err != nil {
+			return nil, err
+		}
+	}
+	return newPack(flattenObjs(nil, pack.Objs, depth)), nil
+}
+
+func flattenObjs(res []Object, objs []Object, depth int64) []Object {
+	for _, v := range objs {
+		if inner, ok := v.(PackObj); ok && depth > 0 {
+			res = flattenObjs(res, inner.Pack.Objs, depth-1)
+		} else {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+func (in *Interpreter) tableMap(args []Object) (Object, *EvalError) {
+	table, err := argTable("table.map", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	fn, err := argCallable("table.map", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	res := newTable()
+	for _, k := range sortedKeys(table) {
+		obj, err := callFunction(in, fn, []Object{table.Store[k], k})
+		if err != nil {
+			return nil, err
+		}
+		res.Table.set(k, obj)
+	}
+	return res, nil
+}
+
+func (in *Interpreter) tableFilter(args []Object) (Object, *EvalError) {
+	table, err := argTable("table.filter", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	fn, err := argCallable("table.filter", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	res := newTable()
+	for _, k := range sortedKeys(table) {
+		v := table.Store[k]
+		keep, err := callFunction(in, fn, []Object{v, k})
+		if err != nil {
+			return nil, err
+		}
+		if toBooleanObj(keep).Value {
+			res.Table.set(k, v)
+		}
+	}
+	return res, nil
+}
+
+// table.reduce(t, fn(acc, value, key), init)
+func (in *Interpreter) tableReduce(args []Object) (Object, *EvalError) {
+	table, err := argTable("table.reduce", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	fn, err := argCallable("table.reduce", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNArgs("table.reduce", args, 3); err != nil {
+		return nil, err
+	}
+	acc := args[2]
+	for _, k := range sortedKeys(table) {
+		if acc, err = callFunction(in, fn, []Object{acc, table.Store[k], k}); err != nil {
+			return nil, err
+		}
+	}
+	return acc, nil
+}
+
+func tableKeys(args []Object) (Object, *EvalError) {
+	table, err := argTable("table.keys", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return newPack(sortedKeys(table)), nil
+}
+
+func tableValues(args []Object) (Object, *EvalError) {
+	table, err := argTable("table.values", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	keys := sortedKeys(table)
+	res := make([]Object, 0, len(keys))
+	for _, k := range keys {
+		res = append(res, table.Store[k])
+	}
+	return newPack(res), nil
+}
+
+func (in *Interpreter) tableContains(args []Object) (Object, *EvalError) {
+	table, err := argTable("table.contains", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNArgs("table.contains", args, 2); err != nil {
+		return nil, err
+	}
+	values := make([]Object, 0, len(table.Store))
+	for _, v := range table.Store {
+		values = append(values, v)
+	}
+	ok, err := containsObj(in, values, args[1])
+	if err != nil {
+		return nil, err
+	}
+	return BooleanObj{Value: ok}, nil
+}
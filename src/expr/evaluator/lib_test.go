@@ -0,0 +1,725 @@
+package evaluator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestInterpreterBind(t *testing.T) {
+	in := NewInterpreter()
+	in.Bind("answer", IntegerObj{Value: 42})
+	in.BindFunc("double", func(args []Object) (Object, *EvalError) {
+		n, err := argInteger("double", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		return IntegerObj{Value: n * 2}, nil
+	})
+	testLib(t, in, `f := func() return double(answer); return f()`, IntegerObj{Value: 84})
+	testLib(t, in, `x := 1; return x`, IntegerObj{Value: 1})
+	testLibError(t, in, `return double("a")`)
+}
+
+func TestSharedGlobals(t *testing.T) {
+	loader := MapLoader{"inc.expr": `return func(x) return x + 1`}
+	base := NewInterpreter(WithModuleLoader(loader))
+	config, _ := base.ExecString(`return table{ limit = 10, tags = table{ a = 1 } }`)
+	scale, _ := base.ExecString(`factor := 3; return func(x)[factor] { factor = factor * 1; return x * factor }`)
+	base.Bind("config", config)
+	base.Bind("scale", scale)
+	// 共享的函数使用调用方解释器的标准库和模块，不会并发访问 base 的正则缓存、随机数和模块表
+	check, _ := base.ExecString(`return func(s) {
+	inc := import "inc.expr"
+	if re.match("^${s}$", s) { return inc(math.random(1, 1)) }
+	return 0
+}`)
+	base.Bind("check", check)
+	// 函数作为表的键，冻结前后、在共享的解释器中都能查到
+	handlers, _ := base.ExecString(`h := table{}; h.[check] = "ok"; return h`)
+	base.Bind("handlers", handlers)
+	testLib(t, base, `return handlers.[check]`, StringObj{Value: "ok"})
+	base.Bind("counter", IntegerObj{Value: 0})
+	shared := base.Globals()
+	shared.Freeze()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			in := NewInterpreter(WithSharedGlobals(shared), WithModuleLoader(loader))
+			in.Bind("id", IntegerObj{Value: int64(i)})
+			testLib(t, in, `[a] := pack.map(["x${id}"], check); return check("id${id}") + a`, IntegerObj{Value: 4})
+			testLib(t, in, `
+counter = counter + id
+f := func()[counter] { counter += 1; return counter }
+f()
+return scale(counter) + config.limit + config.tags.a`, IntegerObj{Value: int64((i+1)*3 + 11)})
+			testLib(t, in, `config := 1; return config`, IntegerObj{Value: 1})
+			testLib(t, in, `f := check; return "${handlers.[f]}${handlers.[check]}"`, StringObj{Value: "okok"})
+			testLibError(t, in, `config.limit = 1`)
+			testLibError(t, in, `config.tags.a += 1`)
+			testLibError(t, in, `setmeta(config, table{})`)
+		}(i)
+	}
+	wg.Wait()
+	if counter := *shared.Get("counter"); counter != (IntegerObj{Value: 0}) {
+		t.Errorf("shared globals modified: %v", counter)
+	}
+	testLib(t, base, `return config.limit`, IntegerObj{Value: 10})
+	testLib(t, base, `return handlers.[check]`, StringObj{Value: "ok"})
+}
+
+func TestStrictArity(t *testing.T) {
+	in := NewInterpreter(WithStrictArity())
+	testLib(t, in, `f := func(a, b = 2) return a + b; return f(1) + f(1, 1)`, IntegerObj{Value: 5})
+	testLib(t, in, `f := func(a, ...rest) return len(rest); return f(1, 2, 3)`, IntegerObj{Value: 2})
+	testLib(t, in, `return len([1, 2])`, IntegerObj{Value: 2})
+	for input, message := range map[string]string{
+		`f := func(a, b) 1; f(1)`:           "func at line 1: expect 2 arguments, got 1",
+		`f := func(a, b = 1) 1; f(1, 2, 3)`: "func at line 1: expect 1 to 2 arguments, got 3",
+		`f := func(a, ...rest) 1; f()`:      "func at line 1: expect at least 1 arguments, got 0",
+		`f := func(a = 1, b) 1; f()`:        "func at line 1: expect 2 arguments, got 0",
+	} {
+		_, err := in.ExecString(input)
+		if err == nil || err.(*EvalError).Message != message {
+			t.Errorf("input %s: expect error %s, got %v", input, message, err)
+		}
+	}
+	testLib(t, in, `f := func(a, b = 2) return a + b; return f(b = 1, a = 1)`, IntegerObj{Value: 2})
+	testLibError(t, in, `f := func(a, b) 1; f(b = 1)`)
+	testLib(t, NewInterpreter(), `f := func(a, b) return b; return f(1)`, NilObj)
+}
+
+func TestNativeNamedArgs(t *testing.T) {
+	in := NewInterpreter()
+	in.BindFunc("request", func(args []Object) (Object, *EvalError) {
+		url, err := argString("request", args, 0)
+		if err != nil {
+			return nil, err
+		}
+		timeout := IntegerObj{Value: 30}
+		if len(args) > 1 {
+			opts, err := argTable("request", args, len(args)-1)
+			if err != nil {
+				return nil, err
+			}
+			if v, ok := opts.Store[StringObj{Value: "timeout"}].(IntegerObj); ok {
+				timeout = v
+			}
+		}
+		return StringObj{Value: fmt.Sprintf("%s %d %d", url, timeout.Value, len(args))}, nil
+	})
+	testLib(t, in, `return request("a", timeout = 5, retries = 3)`, StringObj{Value: "a 5 2"})
+	testLib(t, in, `return request("b")`, StringObj{Value: "b 30 1"})
+	testLibError(t, in, `request("a", timeout = 1, timeout = 2)`)
+}
+
+func TestStringLib(t *testing.T) {
+	in := NewInterpreter()
+	testLib(t, in, `return string.join(string.split("a,b,c", ","), "-")`, StringObj{Value: "a-b-c"})
+	testLib(t, in, `return len(string.split("你好", ""))`, IntegerObj{Value: 2})
+	testLib(t, in, `return string.join([1, 2.5, true], ", ")`, StringObj{Value: "1, 2.5, true"})
+	testLib(t, in, `return string.trim("  hi  ")`, StringObj{Value: "hi"})
+	testLib(t, in, `return string.trim("xxhixx", "x")`, StringObj{Value: "hi"})
+	testLib(t, in, `return "${string.upper("abc")}${string.lower("DEF")}"`, StringObj{Value: "ABCdef"})
+	testLib(t, in, `return string.replace("aaa", "a", "b")`, StringObj{Value: "bbb"})
+	testLib(t, in, `return string.replace("aaa", "a", "b", 2)`, StringObj{Value: "bba"})
+	testLib(t, in, `return string.find("你好世界", "世界")`, IntegerObj{Value: 3})
+	testLib(t, in, `return string.find("abcabc", "c", 4)`, IntegerObj{Value: 6})
+	testLib(t, in, `return string.find("abc", "x")`, NilObj)
+	testLib(t, in, `return string.startswith("hello", "he") and string.endswith("hello", "lo")`, BooleanObj{Value: true})
+	testLib(t, in, `return string.repeat("ab", 3)`, StringObj{Value: "ababab"})
+	testLib(t, in, `return string.repeat("ab", 3, ",")`, StringObj{Value: "ab,ab,ab"})
+	testLib(t, in, `return string.sub("hello", 2, 4)`, StringObj{Value: "ell"})
+	testLib(t, in, `return string.sub("你好世界", -2)`, StringObj{Value: "世界"})
+	testLib(t, in, `return string.sub("hello", 4, 2)`, StringObj{Value: ""})
+	testLib(t, in, `return string.format("%s has %d items (%.2f%%)", "cart", 3, 12.5)`, StringObj{Value: "cart has 3 items (12.50%)"})
+	testLib(t, in, `return string.format("%5d|%-4s|%x|%q|%v", 42, "ab", 255, "hi", [1])`, StringObj{Value: "   42|ab  |ff|\"hi\"|[1]"})
+
+	testLibError(t, in, `return string.upper(1)`)
+	testLibError(t, in, `return string.split("a")`)
+	testLibError(t, in, `return string.repeat("a", -1)`)
+	testLibError(t, in, `return string.repeat("ab", 9223372036854775807)`)
+	testLibError(t, in, `return string.repeat("a", 1 << 40, ",")`)
+	testLib(t, in, `return try string.repeat("a", 1 << 40) catch e break "caught"`, StringObj{Value: "caught"})
+	testLib(t, in, `return string.repeat("", 1 << 40)`, StringObj{Value: ""})
+	testLibError(t, in, `return string.format("%d", "a")`)
+	testLibError(t, in, `return string.format("%d %d", 1)`)
+	testLibError(t, in, `return string.format("%z", 1)`)
+}
+
+func TestMathLib(t *testing.T) {
+	in := NewInterpreter()
+	testLib(t, in, `return math.abs(-3)`, IntegerObj{Value: 3})
+	testLib(t, in, `return math.abs(-2.5)`, FloatObj{Value: 2.5})
+	testLib(t, in, `return math.abs(math.minint)`, nil)
+	testLib(t, in, `return math.floor(2.7) + math.ceil(2.1) + math.round(2.5)`, IntegerObj{Value: 8})
+	testLib(t, in, `return math.floor(-2.5)`, IntegerObj{Value: -3})
+	testLib(t, in, `return math.floor(5)`, IntegerObj{Value: 5})
+	testLib(t, in, `return math.sqrt(16)`, FloatObj{Value: 4})
+	testLib(t, in, `return math.pow(2, 10)`, FloatObj{Value: 1024})
+	testLib(t, in, `return math.log(8, 2)`, FloatObj{Value: 3})
+	testLib(t, in, `return math.log(1)`, FloatObj{Value: 0})
+	testLib(t, in, `return math.sin(0) + math.cos(0)`, FloatObj{Value: 1})
+	testLib(t, in, `return math.round(math.atan(1, 1) * 4 * 1000) == math.round(math.pi * 1000)`, BooleanObj{Value: true})
+	testLib(t, in, `return math.min(3, 1.5, 2)`, FloatObj{Value: 1.5})
+	testLib(t, in, `return math.max(3, 7, 2)`, IntegerObj{Value: 7})
+	testLib(t, in, `return math.isnan(math.nan) and !math.isnan(1.0)`, BooleanObj{Value: true})
+	testLib(t, in, `return math.isinf(-math.inf) and math.inf > math.maxint`, BooleanObj{Value: true})
+	testLib(t, in, `return math.toint(-3.9)`, IntegerObj{Value: -3})
+	testLib(t, in, `return math.toint("0x1f")`, IntegerObj{Value: 31})
+	testLib(t, in, `return math.toint("abc")`, NilObj)
+	testLib(t, in, `return math.tofloat(3)`, FloatObj{Value: 3})
+	testLib(t, in, `return math.tofloat("1.5e2")`, FloatObj{Value: 150})
+
+	obj := testLib(t, in, `return math.toint(1e20)`, nil)
+	if v, ok := obj.(BigIntObj); !ok || v.Value.String() != "100000000000000000000" {
+		t.Errorf("math.toint(1e20) got %v", obj)
+	}
+
+	testLibError(t, in, `return math.sqrt("a")`)
+	testLibError(t, in, `return math.floor(math.nan)`)
+	testLibError(t, in, `return math.min()`)
+	testLibError(t, in, `return math.random(5, 1)`)
+}
+
+func TestMathRandom(t *testing.T) {
+	run := func() Object {
+		in := NewInterpreter(WithRandSeed(42))
+		return testLib(t, in, `return [math.random(), math.random(100), math.random(-5, 5)]`, nil)
+	}
+	a, b := run(), run()
+	sa, _ := toString(a)
+	sb, _ := toString(b)
+	if sa != sb {
+		t.Errorf("math.random with same seed mismatch: %s %s", sa, sb)
+	}
+
+	in := NewInterpreter()
+	testLib(t, in, `
+math.randomseed(7)
+a := math.random(1000000)
+math.randomseed(7)
+return a == math.random(1000000)`, BooleanObj{Value: true})
+	testLib(t, in, `x := math.random(3, 4); return x == 3 or x == 4`, BooleanObj{Value: true})
+	testLib(t, in, `x := math.random(); return x >= 0 and x < 1`, BooleanObj{Value: true})
+}
+
+func TestPackLib(t *testing.T) {
+	in := NewInterpreter()
+	testLib(t, in, `
+double := func(x) return x * 2
+return tostring(pack.map([1, 2, 3], double))`, StringObj{Value: "[2, 4, 6]"})
+	testLib(t, in, `return tostring(pack.map(["a", "b"], func(v, i) return "${i}${v}"))`, StringObj{Value: "[1a, 2b]"})
+	testLib(t, in, `return tostring(pack.filter([1, 2, 3, 4], func(x) return x % 2 == 0))`, StringObj{Value: "[2, 4]"})
+	testLib(t, in, `return pack.reduce([1, 2, 3, 4], func(acc, x) return acc + x)`, IntegerObj{Value: 10})
+	testLib(t, in, `return pack.reduce([], func(acc, x) return acc + x, 100)`, IntegerObj{Value: 100})
+	testLib(t, in, `return tostring(pack.sort([3, 1.5, 2]))`, StringObj{Value: "[1.5, 2, 3]"})
+	testLib(t, in, `return tostring(pack.sort(["b", "c", "a"]))`, StringObj{Value: "[a, b, c]"})
+	testLib(t, in, `return tostring(pack.sort([2, 3, 1], func(a, b) return a > b))`, StringObj{Value: "[3, 2, 1]"})
+	testLib(t, in, `
+p := [3, 1, 2]
+pack.sort(p)
+return tostring(p)`, StringObj{Value: "[3, 1, 2]"})
+	testLib(t, in, `return tostring(pack.keys(["a", "b"]))`, StringObj{Value: "[1, 2]"})
+	testLib(t, in, `return pack.contains([1, "a", 2.0], 2) and !pack.contains([1], "1")`, BooleanObj{Value: true})
+	testLib(t, in, `return tostring(pack.reverse([1, 2, 3]))`, StringObj{Value: "[3, 2, 1]"})
+	testLib(t, in, `return tostring(pack.unique([1, 2, 1, "a", "a", 3]))`, StringObj{Value: "[1, 2, a, 3]"})
+	testLib(t, in, `return tostring(pack.unique([1, 1.0, 2, 2.5, 2.5, 1.5]))`, StringObj{Value: "[1, 2, 2.5, 1.5]"})
+	testLib(t, in, `return len(pack.unique([2 ** 64, 18446744073709551616.0, -0.0, 0, math.nan, math.nan]))`, IntegerObj{Value: 4})
+	testLib(t, in, `return tostring(pack.zip([1, 2, 3], ["a", "b"]))`, StringObj{Value: "[[1, a], [2, b]]"})
+	testLib(t, in, `return tostring(pack.flatten([1, [2, [3, [4]]]]))`, StringObj{Value: "[1, 2, [3, [4]]]"})
+	testLib(t, in, `return tostring(pack.flatten([1, [2, [3, [4]]]], 10))`, StringObj{Value: "[1, 2, 3, 4]"})
+
+	testLibError(t, in, `return pack.map([1], 1)`)
+	testLibError(t, in, `return pack.map(table{}, func(x) return x)`)
+	testLibError(t, in, `return pack.reduce([], func(acc, x) return acc + x)`)
+	testLibError(t, in, `return pack.sort([1, "a"])`)
+	testLibError(t, in, `return pack.map([1], func(x) return x + "a")`)
+}
+
+func TestTableLib(t *testing.T) {
+	in := NewInterpreter()
+	testLib(t, in, `return tostring(table.keys(table{ b = 1, a = 2, [2] = 3, [1] = 4 }))`, StringObj{Value: "[1, 2, a, b]"})
+	testLib(t, in, `return tostring(table.values(table{ b = 1, a = 2 }))`, StringObj{Value: "[2, 1]"})
+	testLib(t, in, `
+t := table.map(table{ x = 1, y = 2 }, func(v, k) return v * 10)
+return t.x + t.y`, IntegerObj{Value: 30})
+	testLib(t, in, `
+t := table.filter(table{ x = 1, y = 2, z = 3 }, func(v) return v > 1)
+return tostring(table.keys(t))`, StringObj{Value: "[y, z]"})
+	testLib(t, in, `return table.reduce(table{ a = 1, b = 2 }, func(acc, v, k) return "${acc}${k}${v}", "")`, StringObj{Value: "a1b2"})
+	testLib(t, in, `return table.contains(table{ a = "x" }, "x")`, BooleanObj{Value: true})
+	testLib(t, in, `t := table{ n = 1 }; return t.n`, IntegerObj{Value: 1})
+	testLib(t, in, `
+mt := table{ __tostring = func(self) throw "tostring called" }
+t := table{}
+for i := 1; i <= 20; i++ { t.[setmeta(table{}, mt)] = i }
+t.[print] = "f"
+s := ""
+for k, v in t { s = "${s}${v}," }
+return "${s}${table.reduce(t, func(acc, v) return "${acc}${v},", "")}"`,
+		StringObj{Value: strings.Repeat("1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17,18,19,20,f,", 2)})
+
+	counter := 0
+	in.BindFunc("count", func(args []Object) (Object, *EvalError) {
+		counter++
+		return CallFunction(args[0], IntegerObj{Value: int64(counter)})
+	})
+	testLib(t, in, `return count(func(n) return n * 100)`, IntegerObj{Value: 100})
+}
+
+func TestJSONLib(t *testing.T) {
+	in := NewInterpreter()
+	in.Bind("quoted", StringObj{Value: `x"y`})
+	testLib(t, in, `return json.encode(table{ b = [1, 2.5, 3.0], a = quoted, c = nil, d = true })`,
+		StringObj{Value: `{"a":"x\"y","b":[1,2.5,3.0],"c":null,"d":true}`})
+	testLib(t, in, `return json.encode(table{ a = [], b = table{} })`, StringObj{Value: `{"a":[],"b":{}}`})
+	testLib(t, in, `return json.encode("<é>")`, StringObj{Value: `"<é>"`})
+	testLib(t, in, `return json.encode(100000000000000000000)`, StringObj{Value: `100000000000000000000`})
+	testLib(t, in, `return json.encode(table{ a = [1, table{ b = 2 }] }, table{ pretty = true })`, StringObj{Value: `{
+  "a": [
+    1,
+    {
+      "b": 2
+    }
+  ]
+}`})
+	testLib(t, in, `return json.encode([1], table{ indent = "--" })`, StringObj{Value: "[\n--1\n]"})
+
+	in.Bind("payload", StringObj{Value: `{"name": "Ann", "tags": ["a", "b"], "age": 30, "score": 9.5, "x": null}`})
+
+	testLib(t, in, `
+v := json.decode(payload)
+[t1, t2] := v.tags
+return "${v.name} ${t1}${t2} ${v.age + 1} ${v.score} ${v.x}"`, StringObj{Value: "Ann ab 31 9.5 nil"})
+	testLib(t, in, `return json.decode("1e2")`, FloatObj{Value: 100})
+	testLib(t, in, `return json.decode("-7")`, IntegerObj{Value: -7})
+	testLib(t, in, `return tostring(json.decode("123456789012345678901234567890"))`, StringObj{Value: "123456789012345678901234567890"})
+	in.Bind("compact", StringObj{Value: `{"a":[1,2.5,{"b":null}],"c":"\u003c"}`})
+	testLib(t, in, `return json.encode(json.decode(compact))`, StringObj{Value: `{"a":[1,2.5,{"b":null}],"c":"<"}`})
+
+	testLibError(t, in, `return json.encode(table{ [1] = 2 })`)
+	testLibError(t, in, `return json.encode(table{ f = func() return 1 })`)
+	testLibError(t, in, `return json.encode(math.nan)`)
+	testLibError(t, in, `t := table{}; t.self = t; return json.encode(t)`)
+	testLibError(t, in, `return json.decode("{")`)
+	testLibError(t, in, `return json.decode("1 2")`)
+
+	if _, err := in.ExecString(`t := table{ a = table{} }; t.a.b = t; return json.encode(t)`); err == nil ||
+		!strings.Contains(err.Error(), "cycle detected at $.a.b") {
+		t.Errorf("json.encode cycle error mismatch: %v", err)
+	}
+	testLib(t, in, `s := table{ x = 1 }; return json.encode([s, s])`, StringObj{Value: `[{"x":1},{"x":1}]`})
+}
+
+func TestRegexpLib(t *testing.T) {
+	in := NewInterpreter()
+	testLib(t, in, `return re.match("^\d+$", "12345") and !re.match("^\d+$", "12a")`, BooleanObj{Value: true})
+	testLib(t, in, `
+r := re.compile("(\w+)@(\w+)\.com")
+[all, user, host] := r:find("mail: ann@example.com")
+return "${all}|${user}|${host}"`, StringObj{Value: "ann@example.com|ann|example"})
+	testLib(t, in, `return re.find("x", "abc")`, NilObj)
+	testLib(t, in, `
+m := re.find("(?P<year>\d{4})-(?P<month>\d{2})", "date: 2024-05")
+return "${m.year}/${m.month} ${m.[0]}"`, StringObj{Value: "2024/05 2024-05"})
+	testLib(t, in, `return tostring(re.findall("\d+", "a1b22c333"))`, StringObj{Value: "[1, 22, 333]"})
+	testLib(t, in, `return tostring(re.findall("\d+", "a1b22c333", 2))`, StringObj{Value: "[1, 22]"})
+	testLib(t, in, `return tostring(re.findall("(\w)=(\d)", "a=1 b=2"))`, StringObj{Value: "[[a=1, a, 1], [b=2, b, 2]]"})
+	testLib(t, in, `return re.replace("(\w+)@(\w+)", "ann@host bob@web", "$2:$1")`, StringObj{Value: "host:ann web:bob"})
+	testLib(t, in, `return re.replace("(?P<n>\d+)", "a1b2", "<\${n}>")`, StringObj{Value: "a<1>b<2>"})
+	testLib(t, in, `return re.replace("\d+", "a1b22", func(m) return len(m))`, StringObj{Value: "a1b2"})
+	testLib(t, in, `return re.replace("(\d)(\d)?", "1 23", func(m, a, b) return "${b}${a}")`, StringObj{Value: "nil1 32"})
+	testLib(t, in, `return tostring(re.split("\s*,\s*", "a , b,c"))`, StringObj{Value: "[a, b, c]"})
+	testLib(t, in, `return re.escape("a.b*c")`, StringObj{Value: "a\\.b\\*c"})
+	testLib(t, in, `return tostring(re.compile("a+"))`, StringObj{Value: "regexp: a+"})
+	testLib(t, in, `r := re.compile("a+"); return re.match(r, "caat")`, BooleanObj{Value: true})
+
+	testLibError(t, in, `return re.compile("(")`)
+	testLibError(t, in, `return re.match(table{ pattern = "a" }, "a")`)
+	testLibError(t, in, `return re.replace("a", "a", 1)`)
+	testLibError(t, in, `return re.replace("a", "a", func(m) return 1 + nil)`)
+}
+
+type fixedClock struct {
+	now time.Time
+}
+
+func (c *fixedClock) Now() time.Time {
+	return c.now
+}
+
+func TestTimeLib(t *testing.T) {
+	clock := &fixedClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	in := NewInterpreter(WithClock(clock))
+	testLib(t, in, `return time.format(time.now())`, StringObj{Value: "2024-05-01T12:00:00Z"})
+	testLib(t, in, `return time.format(time.now() + 90 * time.minute, "15:04")`, StringObj{Value: "13:30"})
+	testLib(t, in, `return time.format(time.now(), "DateOnly")`, StringObj{Value: "2024-05-01"})
+	testLib(t, in, `
+start := time.parse("DateTime", "2024-05-01 08:30:00")
+return tostring(time.now() - start)`, StringObj{Value: "3h30m0s"})
+	testLib(t, in, `return time.parse("RFC3339", "2024-05-01T12:00:00Z") == time.now()`, BooleanObj{Value: true})
+	testLib(t, in, `return time.date(2024, 1, 1) < time.now() and time.now() <= time.now()`, BooleanObj{Value: true})
+	testLib(t, in, `return time.duration("1h30m") > time.hour and time.duration(1.5) == 1500 * time.millisecond`, BooleanObj{Value: true})
+	testLib(t, in, `return time.seconds(time.duration("2m") / 4)`, FloatObj{Value: 30})
+	testLib(t, in, `return time.hour / time.minute`, FloatObj{Value: 60})
+	testLib(t, in, `return time.unix(time.fromunix(1700000000))`, IntegerObj{Value: 1700000000})
+	testLib(t, in, `
+f := time.fields(time.date(2024, 2, 29, 23, 59, 58))
+return "${f.year}-${f.month}-${f.day} ${f.hour}:${f.minute}:${f.second} ${f.weekday} ${f.yearday}"`, StringObj{Value: "2024-2-29 23:59:58 4 60"})
+	testLib(t, in, `return tostring(pack.sort([time.date(2025, 1, 1), time.date(2023, 1, 1)]))`,
+		StringObj{Value: "[2023-01-01T00:00:00Z, 2025-01-01T00:00:00Z]"})
+
+	clock.now = clock.now.Add(time.Hour)
+	testLib(t, in, `return tostring(time.since(time.date(2024, 5, 1, 12, 0, 0)))`, StringObj{Value: "1h0m0s"})
+
+	testLibError(t, in, `return time.parse("DateOnly", "2024/05/01")`)
+	testLibError(t, in, `return time.now() + 1`)
+	testLibError(t, in, `return time.now() * 2`)
+	testLibError(t, in, `return time.hour / 0`)
+	testLibError(t, in, `return time.format("2024")`)
+	testLibError(t, in, `return time.duration("abc")`)
+	testLibError(t, in, `return time.duration(10000000000)`)
+	testLibError(t, in, `return time.duration(1) * 100000000000`)
+	testLibError(t, in, `return -3 * (time.hour * 1000000)`)
+	testLib(t, in, `return try time.duration(1) * 100000000000 catch e break e.message`, StringObj{Value: "duration out of range"})
+}
+
+func TestIOLib(t *testing.T) {
+	testLibError(t, NewInterpreter(), `return io.readfile("a.txt")`)
+
+	fsys := fstest.MapFS{
+		"a.txt":          {Data: []byte("hello")},
+		"data/lines.txt": {Data: []byte("one\r\ntwo\n\nthree")},
+		"data/sub/x":     {Data: []byte("x")},
+	}
+	in := NewInterpreter(WithFS(fsys))
+	testLib(t, in, `return io.readfile("a.txt")`, StringObj{Value: "hello"})
+	testLib(t, in, `return io.readfile("./data/../a.txt")`, StringObj{Value: "hello"})
+	testLib(t, in, `return tostring(io.listdir())`, StringObj{Value: "[a.txt, data/]"})
+	testLib(t, in, `return tostring(io.listdir("data"))`, StringObj{Value: "[lines.txt, sub/]"})
+	testLib(t, in, `return io.exists("data/sub/x") and !io.exists("missing")`, BooleanObj{Value: true})
+	testLib(t, in, `
+next := io.lines("data/lines.txt")
+a := next(); b := next(); c := next(); d := next()
+return "${a}|${b}|${c}|${d}|${next()}"`, StringObj{Value: "one|two||three|nil"})
+
+	testLibError(t, in, `return io.writefile("b.txt", "x")`)
+	testLibError(t, in, `return io.readfile("missing")`)
+	for _, p := range []string{"../a.txt", "data/../../a.txt", "/etc/passwd", ".."} {
+		if _, err := in.ExecString(`return io.readfile("` + p + `")`); err == nil ||
+			!strings.Contains(err.Error(), "outside the root") {
+			t.Errorf("expect path traversal error for %s, got %v", p, err)
+		}
+	}
+}
+
+func TestIOWritableFS(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "root")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(parent, "secret"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../secret", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	fsys, err := NewDirFS(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fsys.Close()
+
+	in := NewInterpreter(WithWritableFS(fsys))
+	testLib(t, in, `io.writefile("out.txt", "data"); return io.readfile("out.txt")`, StringObj{Value: "data"})
+	if data, err := os.ReadFile(filepath.Join(dir, "out.txt")); err != nil || string(data) != "data" {
+		t.Errorf("io.writefile result mismatch: %q %v", data, err)
+	}
+	testLibError(t, in, `return io.writefile("../escape.txt", "x")`)
+	testLibError(t, in, `return io.readfile("link")`)
+	testLibError(t, in, `return io.writefile("link", "x")`)
+	testLibError(t, in, `return io.writefile("nodir/out.txt", "x")`)
+	if data, _ := os.ReadFile(filepath.Join(parent, "secret")); string(data) != "secret" {
+		t.Errorf("file outside the root was modified")
+	}
+}
+
+func TestImport(t *testing.T) {
+	loader := MapLoader{
+		"util.expr": `
+prefix := "v"
+version := func(n)[prefix] return "${prefix}${n}"
+counter := table{ n = 0 }
+counter.n++`,
+		"lib/vec.expr": `
+add := func(a, b) return table{ x = a.x + b.x, y = a.y + b.y }
+return table{ add = add, zero = table{ x = 0, y = 0 } }`,
+		"a.expr":     `b := import "b.expr"; x := 1`,
+		"b.expr":     `c := import "c.expr"`,
+		"c.expr":     `a := import "a.expr"`,
+		"bad.expr":   `x := `,
+		"err.expr":   `return 1 + nil`,
+		"throw.expr": `f := func() throw table{ message = "boom", code = 1 }; f()`,
+		"self.expr":  `x := import "./self.expr"`,
+	}
+	in := NewInterpreter(WithModuleLoader(loader))
+	testLib(t, in, `util := import "util.expr"; return util.version(3)`, StringObj{Value: "v3"})
+	testLib(t, in, `
+u1 := import "util.expr"
+u2 := import "./util.expr"
+return u1 == u2 and u1.counter.n == 1`, BooleanObj{Value: true})
+	testLib(t, in, `
+vec := import "lib/vec.expr"
+p := vec.add(table{ x = 1, y = 2 }, table{ x = 3, y = 4 })
+return "${p.x},${p.y}"`, StringObj{Value: "4,6"})
+	testLib(t, in, `return (import "lib/vec.expr").zero.x`, IntegerObj{Value: 0})
+	testLib(t, in, `prefix := "local"; return (import "util.expr").prefix`, StringObj{Value: "v"})
+
+	if _, err := in.ExecString(`return import "a.expr"`); err == nil ||
+		!strings.Contains(err.Error(), "import cycle: a.expr -> b.expr -> c.expr -> a.expr") {
+		t.Errorf("import cycle error mismatch: %v", err)
+	}
+	testLibError(t, in, `return import "self.expr"`)
+	testLibError(t, in, `return import "missing.expr"`)
+	testLibError(t, in, `return import "bad.expr"`)
+	testLibError(t, in, `return import "err.expr"`)
+	testLib(t, in, `return try import "throw.expr" catch e break "${e.message}:${e.data.code}"`, StringObj{Value: "boom:1"})
+	if _, err := in.ExecString(`return import "throw.expr"`); err == nil || err.(*EvalError).Value == nil ||
+		err.(*EvalError).Message != `import "throw.expr": boom` || len(err.(*EvalError).Traceback) == 0 {
+		t.Errorf("import error should keep thrown value and traceback: %v", err)
+	}
+	testLibError(t, in, `return import "../util.expr"`)
+	testLibError(t, NewInterpreter(), `return import "util.expr"`)
+
+	fsys := fstest.MapFS{"m/hello.expr": {Data: []byte(`greet := func(name) return "hello ${name}"`)}}
+	in = NewInterpreter(WithModuleLoader(FSLoader{FS: fsys}))
+	testLib(t, in, `return (import "m/hello.expr").greet("fs")`, StringObj{Value: "hello fs"})
+}
+
+func TestSpawn(t *testing.T) {
+	in := NewInterpreter()
+	testLib(t, in, `
+add := func(a, b) return a + b
+t1 := spawn(add, 1, 2); t2 := spawn(add, 10, 20)
+return await(t1) + t2:await()`, IntegerObj{Value: 33})
+	testLib(t, in, `
+t := spawn(func() throw "task failed")
+return try await(t) catch e break e.message`, StringObj{Value: "task failed"})
+	testLib(t, in, `
+c := chan()
+producer := func(n)[c] { for i := 1; i <= n; i++ { c.send(i) }; c:close() }
+spawn(producer, 4)
+s := ""
+for v in c { s = "${s}${v}" }
+return "${s} ${c.recv()}"`, StringObj{Value: "1234 nil"})
+	testLib(t, in, `
+a := chan(1); b := chan(1)
+b.send("x")
+[v, i] := recv_any(a, b)
+a.close()
+[v2, i2] := recv_any(a)
+return "${v}${i} ${v2}${i2}"`, StringObj{Value: "x2 nil1"})
+
+	// 捕获的变量和表被多个任务交替读写，使用 go test -race 检查
+	in.BindBlockingFunc("pause", func(args []Object) (Object, *EvalError) {
+		time.Sleep(time.Microsecond)
+		return NilObj, nil
+	})
+	testLib(t, in, `
+count := 0; seen := table{}
+worker := func(id)[count, seen] {
+	for i := 0; i < 50; i++ { count += 1; seen.["${id}-${i}"] = true; pause() }
+}
+tasks := table{}
+for i := 0; i < 8; i++ { tasks.[i] = spawn(worker, i) }
+for _, task in tasks { await(task) }
+return "${count} ${len(seen)}"`, StringObj{Value: "400 400"})
+
+	// 阻塞的宿主调用释放 gil，n 个任务必须同时到达才能全部返回
+	const n = 5
+	arrived := make(chan struct{}, n)
+	release := make(chan struct{})
+	in.BindBlockingFunc("rendezvous", func(args []Object) (Object, *EvalError) {
+		arrived <- struct{}{}
+		select {
+		case <-release:
+			return BooleanObj{Value: true}, nil
+		case <-time.After(5 * time.Second):
+			return nil, &EvalError{Message: "rendezvous timeout"}
+		}
+	})
+	go func() {
+		for i := 0; i < n; i++ {
+			<-arrived
+		}
+		close(release)
+	}()
+	testLib(t, in, `
+results := chan(5)
+for i := 0; i < 5; i++ { spawn(func()[results] results.send(rendezvous())) }
+ok := 0
+for i := 0; i < 5; i++ { if results.recv() { ok += 1 } }
+return ok`, IntegerObj{Value: n})
+
+	testLibError(t, in, `c := chan(1); c.close(); c.send(1)`)
+	testLibError(t, in, `c := chan(1); c.close(); c.close()`)
+	testLibError(t, in, `await(1)`)
+	testLibError(t, in, `chan(-1)`)
+	testLibError(t, in, `recv_any(1)`)
+	testLib(t, in, `
+wg := waitgroup(); squares := table{}
+for i := 1; i <= 5; i++ {
+	wg:add()
+	spawn(func(i)[wg, squares] { defer wg.done(); pause(); squares.[i] = i * i }, i)
+}
+wg.wait()
+sum := 0
+for _, v in squares { sum += v }
+return sum`, IntegerObj{Value: 55})
+	testLib(t, in, `wg := waitgroup(); wg.add(2); wg.done(); wg.add(-1); wg.wait(); wg.wait(); return 1`, IntegerObj{Value: 1})
+
+	testLibError(t, in, `spawn(1)`)
+	testLibError(t, in, `waitgroup().done()`)
+	testLibError(t, in, `waitgroup().add("1")`)
+}
+
+// 宿主在 Run 之外回调脚本：Call 持有 gil，CallFunction 中的阻塞操作直接执行，协程报错
+func TestHostCall(t *testing.T) {
+	in := NewInterpreter()
+	in.BindBlockingFunc("pause", func(args []Object) (Object, *EvalError) {
+		return IntegerObj{Value: 1}, nil
+	})
+	echo, _ := in.ExecString(`return func(v) { c := chan(1); c.send(v); return c.recv() }`)
+	resume, _ := in.ExecString(`return func() { [v] := coroutine.resume(coroutine.create(func() return 2)); return v }`)
+	task, _ := in.ExecString(`return spawn(func() return 3)`)
+	await := *in.Globals().Get("await")
+	pause := *in.Globals().Get("pause")
+
+	for _, call := range []func(fn Object, args ...Object) (Object, *EvalError){in.Call, CallFunction} {
+		if obj, err := call(echo, IntegerObj{Value: 1}); err != nil || obj != (IntegerObj{Value: 1}) {
+			t.Errorf("call channel function: %v %v", obj, err)
+		}
+		if obj, err := call(await, task); err != nil || obj != (IntegerObj{Value: 3}) {
+			t.Errorf("call await: %v %v", obj, err)
+		}
+		if obj, err := call(pause); err != nil || obj != (IntegerObj{Value: 1}) {
+			t.Errorf("call blocking function: %v %v", obj, err)
+		}
+	}
+	if obj, err := in.Call(resume); err != nil || obj != (IntegerObj{Value: 2}) {
+		t.Errorf("call coroutine function: %v %v", obj, err)
+	}
+	if _, err := CallFunction(resume); err == nil || !strings.Contains(err.Message, "no running task") {
+		t.Errorf("expect no running task error, got %v", err)
+	}
+}
+
+// 模块的顶层代码阻塞时，其他任务 import 同一个模块等待其加载完成
+func TestSpawnImport(t *testing.T) {
+	loader := MapLoader{
+		"m.expr":  `value := gate.recv()`,
+		"x1.expr": `pause(); x2 := import "x2.expr"`,
+		"x2.expr": `pause(); x1 := import "x1.expr"`,
+	}
+	in := NewInterpreter(WithModuleLoader(loader))
+	gate, _ := in.ExecString(`return chan()`)
+	in.Bind("gate", gate)
+	in.BindBlockingFunc("pause", func(args []Object) (Object, *EvalError) {
+		time.Sleep(20 * time.Millisecond)
+		return NilObj, nil
+	})
+	testLib(t, in, `
+load := func() return (import "m.expr").value
+a := spawn(load)
+pause()
+b := spawn(load)
+pause()
+gate.send(42)
+return "${await(a)} ${await(b)}"`, StringObj{Value: "42 42"})
+
+	// 两个任务互相等待对方加载的模块时报告循环导入，而不是死锁
+	obj, err := in.ExecString(`
+a := spawn(func() return try import "x1.expr" catch e break e.message)
+b := spawn(func() return try import "x2.expr" catch e break e.message)
+return [await(a), await(b)]`)
+	if err != nil {
+		t.Fatalf("import cycle between tasks: %v", err)
+	}
+	for _, msg := range obj.(PackObj).Pack.Objs {
+		if s, ok := msg.(StringObj); !ok || !strings.Contains(s.Value, "import cycle") {
+			t.Errorf("expect import cycle error, got %v", msg)
+		}
+	}
+}
+
+func TestCoroutineLib(t *testing.T) {
+	in := NewInterpreter()
+	testLib(t, in, `
+co := coroutine.create(func(a, b) {
+	[x] := coroutine.yield(a + b, a - b)
+	[y, z] := coroutine.yield(x * 10)
+	return "${y}${z}"
+})
+s := coroutine.status(co)
+r1 := coroutine.resume(co, 5, 3)
+s = "${s} ${tostring(r1)} ${coroutine.status(co)}"
+r2 := coroutine.resume(co, 7)
+r3 := coroutine.resume(co, "x", "y")
+return "${s} ${tostring(r2)} ${tostring(r3)} ${coroutine.status(co)}"`,
+		StringObj{Value: "suspended [8, 2] suspended [70] [xy] dead"})
+	testLib(t, in, `
+h := table{}
+h.inner = coroutine.create(func()[h] coroutine.yield(coroutine.status(h.outer), coroutine.status(h.inner)))
+h.outer = coroutine.create(func()[h] return coroutine.resume(h.inner))
+[r] := coroutine.resume(h.outer)
+return tostring(r)`, StringObj{Value: "[normal, running]"})
+	testLib(t, in, `
+log := table{ s = "" }
+co := coroutine.create(func()[log] { defer log.s = "${log.s}closed"; coroutine.yield(1); log.s = "unreachable" })
+coroutine.resume(co)
+coroutine.close(co)
+return "${log.s} ${coroutine.status(co)}"`, StringObj{Value: "closed dead"})
+	testLib(t, in, `
+co := coroutine.create(func() { coroutine.yield(1); throw "boom" })
+coroutine.resume(co)
+msg := try coroutine.resume(co) catch e break e.message
+return "${msg} ${coroutine.status(co)}"`, StringObj{Value: "boom dead"})
+	in.BindFunc("explode", func(args []Object) (Object, *EvalError) {
+		panic("host panic")
+	})
+	testLib(t, in, `
+co := coroutine.create(func() explode())
+return try coroutine.resume(co) catch e break e.message`, StringObj{Value: "coroutine panic: host panic"})
+	testLibError(t, in, `coroutine.yield(1)`)
+	testLibError(t, in, `co := coroutine.create(func() 1); coroutine.resume(co); coroutine.resume(co)`)
+	testLibError(t, in, `h := table{}; h.co = coroutine.create(func()[h] coroutine.resume(h.co)); coroutine.resume(h.co)`)
+	testLibError(t, in, `coroutine.status(1)`)
+}
+
+func testLibError(t *testing.T, in *Interpreter, input string) {
+	if _, err := in.ExecString(input); err == nil {
+		t.Errorf("expect Eval Error input: %s", input)
+	}
+}
+
+func testLib(t *testing.T, in *Interpreter, input string, expect Object) Object {
+	obj, err := in.ExecString(input)
+	if err != nil {
+		t.Errorf("Eval Error input: %s\n%s", input, err.Error())
+		return nil
+	}
+	if expect != nil && obj != expect {
+		t.Errorf("expect Object mismatch Error input: %s, got %v", input, obj)
+	}
+	return obj
+}
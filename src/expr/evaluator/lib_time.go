@@ -0,0 +1,339 @@
+package evaluator
+
+import (
+	"expr/lexer"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Clock 为 time 模块提供当前时间，测试或回放时可以替换为固定的时钟
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func WithClock(clock Clock) Option {
+	return func(in *Interpreter) {
+		in.clock = clock
+	}
+}
+
+// 可以在 parse/format 中使用的布局名称
+var timeLayouts = map[string]string{
+	"RFC3339":     time.RFC3339,
+	"RFC3339Nano": time.RFC3339Nano,
+	"RFC1123":     time.RFC1123,
+	"DateTime":    time.DateTime,
+	"DateOnly":    time.DateOnly,
+	"TimeOnly":    time.TimeOnly,
+}
+
+// time 模块，时间和时长分别是 TimeObj 和 DurationObj，支持 + - * / 和比较运算
+func newTimeLib(in *Interpreter) TableObj {
+	module := NewModule("time", map[string]NativeFunc{
+		"now":      in.timeNow,
+		"since":    in.timeSince,
+		"parse":    timeParse,
+		"format":   timeFormat,
+		"unix":     timeUnix,
+		"fromunix": timeFromUnix,
+		"date":     timeDate,
+		"fields":   timeFields,
+		"duration": timeDuration,
+		"seconds":  timeSeconds,
+	})
+	units := map[string]time.Duration{
+		"nanosecond":  time.Nanosecond,
+		"microsecond": time.Microsecond,
+		"millisecond": time.Millisecond,
+		"second":      time.Second,
+		"minute":      time.Minute,
+		"hour":        time.Hour,
+	}
+	for name, d := range units {
+		module.Table.Store[StringObj{Value: name}] = DurationObj{Value: d}
+	}
+	for name, layout := range timeLayouts {
+		module.Table.Store[StringObj{Value: name}] = StringObj{Value: layout}
+	}
+	return module
+}
+
+func isTimeObj(obj Object) bool {
+	return obj.Type() == TTimeObj || obj.Type() == TDurationObj
+}
+
+func argTime(name string, args []Object, i int) (time.Time, *EvalError) {
+	if i >= len(args) {
+		return time.Time{}, argMissingError(name, i, "time")
+	}
+	if t, ok := args[i].(TimeObj); ok {
+		return t.Value, nil
+	}
+	return time.Time{}, argTypeError(name, i, "time", args[i])
+}
+
+// 布局参数可以是 Go 的布局字符串，也可以是 timeLayouts 中的名称
+func argLayout(name string, args []Object, i int) (string, *EvalError) {
+	if !hasArg(args, i) {
+		return time.RFC3339, nil
+	}
+	layout, err := argString(name, args, i)
+	if err != nil {
+		return "", err
+	}
+	if l, ok := timeLayouts[layout]; ok {
+		return l, nil
+	}
+	return layout, nil
+}
+
+func compareResult(op lexer.TokenType, c int) (Object, bool, *EvalError) {
+	switch op {
+	case lexer.T_LT:
+		return BooleanObj{Value: c < 0}, true, nil
+	case lexer.T_LE:
+		return BooleanObj{Value: c <= 0}, true, nil
+	case lexer.T_GT:
+		return BooleanObj{Value: c > 0}, true, nil
+	case lexer.T_GE:
+		return BooleanObj{Value: c >= 0}, true, nil
+	case lexer.T_EQ:
+		return BooleanObj{Value: c == 0}, true, nil
+	case lexer.T_NEQ:
+		return BooleanObj{Value: c != 0}, true, nil
+	}
+	return nil, false, nil
+}
+
+func scaleDuration(d time.Duration, n Object, div bool) (Object, bool, *EvalError) {
+	switch n := n.(type) {
+	case IntegerObj:
+		if div {
+			if n.Value == 0 {
+				return nil, true, &EvalError{Message: "duration divide by zero"}
+			}
+			if d == math.MinInt64 && n.Value == -1 {
+				return nil, true, &EvalError{Message: "duration out of range"}
+			}
+			return DurationObj{Value: d / time.Duration(n.Value)}, true, nil
+		}
+		p, ok := checkedMul(int64(d), n.Value).(IntegerObj)
+		if !ok {
+			return nil, true, &EvalError{Message: "duration out of range"}
+		}
+		return DurationObj{Value: time.Duration(p.Value)}, true, nil
+	case FloatObj:
+		f := float64(d) * n.Value
+		if div {
+			f = float64(d) / n.Value
+		}
+		if math.IsNaN(f) || f > math.MaxInt64 || f < math.MinInt64 {
+			return nil, true, &EvalError{Message: "duration out of range"}
+		}
+		return DurationObj{Value: time.Duration(f)}, true, nil
+	}
+	return nil, false, nil
+}
+
+// 返回值 ok 表示运算是否由时间类型处理
+func evalTimeInfix(op lexer.TokenType, left Object, right Object) (Object, bool, *EvalError) {
+	switch l := left.(type) {
+	case TimeObj:
+		switch r := right.(type) {
+		case TimeObj:
+			if op == lexer.T_MINUS {
+				return DurationObj{Value: l.Value.Sub(r.Value)}, true, nil
+			}
+			return compareResult(op, l.Value.Compare(r.Value))
+		case DurationObj:
+			switch op {
+			case lexer.T_PLUS:
+				return TimeObj{Value: l.Value.Add(r.Value)}, true, nil
+			case lexer.T_MINUS:
+				return TimeObj{Value: l.Value.Add(-r.Value)}, true, nil
+			}
+		}
+	case DurationObj:
+		switch r := right.(type) {
+		case TimeObj:
+			if op == lexer.T_PLUS {
+				return TimeObj{Value: r.Value.Add(l.Value)}, true, nil
+			}
+		case DurationObj:
+			switch op {
+			case lexer.T_PLUS:
+				return DurationObj{Value: l.Value + r.Value}, true, nil
+			case lexer.T_MINUS:
+				return DurationObj{Value: l.Value - r.Value}, true, nil
+			case lexer.T_SLASH:
+				return FloatObj{Value: float64(l.Value) / float64(r.Value)}, true, nil
+			}
+			c := 0
+			if l.Value < r.Value {
+				c = -1
+			} else if l.Value > r.Value {
+				c = 1
+			}
+			return compareResult(op, c)
+		default:
+			switch op {
+			case lexer.T_ASTERISK:
+				return scaleDuration(l.Value, right, false)
+			case lexer.T_SLASH:
+				return scaleDuration(l.Value, right, true)
+			}
+		}
+	default:
+		if r, ok := right.(DurationObj); ok && op == lexer.T_ASTERISK {
+			return scaleDuration(r.Value, left, false)
+		}
+	}
+	return nil, false, nil
+}
+
+func (in *Interpreter) timeNow(args []Object) (Object, *EvalError) {
+	return TimeObj{Value: in.clock.Now()}, nil
+}
+
+func (in *Interpreter) timeSince(args []Object) (Object, *EvalError) {
+	t, err := argTime("time.since", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return DurationObj{Value: in.clock.Now().Sub(t)}, nil
+}
+
+// time.parse(layout, s)，没有时区信息时按 UTC 解析
+func timeParse(args []Object) (Object, *EvalError) {
+	layout, err := argLayout("time.parse", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	s, err := argString("time.parse", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	t, e := time.Parse(layout, s)
+	if e != nil {
+		return nil, &EvalError{Message: fmt.Sprintf("time.parse: %s", e.Error())}
+	}
+	return TimeObj{Value: t}, nil
+}
+
+// time.format(t [, layout])，默认使用 RFC3339
+func timeFormat(args []Object) (Object, *EvalError) {
+	t, err := argTime("time.format", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	layout, err := argLayout("time.format", args, 1)
+	if err != nil {
+		return nil, err
+	}
+	return StringObj{Value: t.Format(layout)}, nil
+}
+
+func timeUnix(args []Object) (Object, *EvalError) {
+	t, err := argTime("time.unix", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	return IntegerObj{Value: t.Unix()}, nil
+}
+
+// time.fromunix(sec [, nsec])，返回 UTC 时间
+func timeFromUnix(args []Object) (Object, *EvalError) {
+	sec, err := argInteger("time.fromunix", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	nsec := int64(0)
+	if hasArg(args, 1) {
+		if nsec, err = argInteger("time.fromunix", args, 1); err != nil {
+			return nil, err
+		}
+	}
+	return TimeObj{Value: time.Unix(sec, nsec).UTC()}, nil
+}
+
+// time.date(year, month, day [, hour, minute, second])，返回 UTC 时间
+func timeDate(args []Object) (Object, *EvalError) {
+	if err := checkNArgs("time.date", args, 3); err != nil {
+		return nil, err
+	}
+	fields := [6]int64{}
+	for i := range fields {
+		if i >= len(args) {
+			break
+		}
+		v, err := argInteger("time.date", args, i)
+		if err != nil {
+			return nil, err
+		}
+		fields[i] = v
+	}
+	t := time.Date(int(fields[0]), time.Month(fields[1]), int(fields[2]),
+		int(fields[3]), int(fields[4]), int(fields[5]), 0, time.UTC)
+	return TimeObj{Value: t}, nil
+}
+
+// time.fields(t) 返回包含 year month day hour minute second weekday yearday 的表，weekday 中周日为 0
+func timeFields(args []Object) (Object, *EvalError) {
+	t, err := argTime("time.fields", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	res := newTable()
+	for name, v := range map[string]int{
+		"year":    t.Year(),
+		"month":   int(t.Month()),
+		"day":     t.Day(),
+		"hour":    t.Hour(),
+		"minute":  t.Minute(),
+		"second":  t.Second(),
+		"weekday": int(t.Weekday()),
+		"yearday": t.YearDay(),
+	} {
+		res.Table.Store[StringObj{Value: name}] = IntegerObj{Value: int64(v)}
+	}
+	return res, nil
+}
+
+// time.duration(x)，x 为字符串时按 "1h30m" 的格式解析，为数字时表示秒数
+func timeDuration(args []Object) (Object, *EvalError) {
+	if err := checkNArgs("time.duration", args, 1); err != nil {
+		return nil, err
+	}
+	switch arg := args[0].(type) {
+	case StringObj:
+		d, err := time.ParseDuration(arg.Value)
+		if err != nil {
+			return nil, &EvalError{Message: fmt.Sprintf("time.duration: %s", err.Error())}
+		}
+		return DurationObj{Value: d}, nil
+	case IntegerObj, FloatObj:
+		obj, _, err := scaleDuration(time.Second, arg, false)
+		return obj, err
+	default:
+		return nil, argTypeError("time.duration", 0, "string or number", arg)
+	}
+}
+
+// time.seconds(d) 返回时长的秒数
+func timeSeconds(args []Object) (Object, *EvalError) {
+	if err := checkNArgs("time.seconds", args, 1); err != nil {
+		return nil, err
+	}
+	d, ok := args[0].(DurationObj)
+	if !ok {
+		return nil, argTypeError("time.seconds", 0, "duration", args[0])
+	}
+	return FloatObj{Value: d.Value.Seconds()}, nil
+}
@@ -0,0 +1,234 @@
+package evaluator
+
+import (
+	"expr/lexer"
+	"fmt"
+)
+
+// __index/__newindex 链的最大长度，防止元表成环
+const maxMetaChain = 100
+
+// 以下函数的 in 是调用方所在的解释器，用于调用元方法，见 callFunction
+
+func getMetaMethod(obj Object, event string) Object {
+	table, ok := obj.(TableObj)
+	if !ok || table.Table.Meta == nil {
+		return nil
+	}
+	if h, ok := table.Table.Meta.Store[StringObj{Value: event}]; ok && h != NilObj {
+		return h
+	}
+	return nil
+}
+
+func isCallable(obj Object) bool {
+	switch obj.(type) {
+	case FuncObj, NativeFuncObj:
+		return true
+	case TableObj:
+		return getMetaMethod(obj, "__call") != nil
+	default:
+		return false
+	}
+}
+
+func indexObj(in *Interpreter, obj Object, index Object) (Object, *EvalError) {
+	if err := checkTableKey(index); err != nil {
+		return nil, err
+	}
+	switch o := obj.(type) {
+	case ErrorObj:
+		return indexErrorObj(o, index), nil
+	case GeneratorObj:
+		return indexGeneratorObj(o, index), nil
+	case TaskObj:
+		return indexTaskObj(o, index), nil
+	case ChanObj:
+		return indexChanObj(o, index), nil
+	case WaitGroupObj:
+		return indexWaitGroupObj(o, index), nil
+	}
+	for i := 0; i < maxMetaChain; i++ {
+		table, ok := obj.(TableObj)
+		if !ok {
+			return nil, &EvalError{Message: "eval an index of non table"}
+		}
+		if res, ok := table.Table.Store[index]; ok {
+			return res, nil
+		}
+		h := getMetaMethod(table, "__index")
+		if h == nil {
+			return NilObj, nil
+		}
+		if isCallable(h) {
+			return callFunction(in, h, []Object{table, index})
+		}
+		obj = h
+	}
+	return nil, &EvalError{Message: "__index chain too long"}
+}
+
+func indexErrorObj(e ErrorObj, index Object) Object {
+	key, _ := index.(StringObj)
+	switch key.Value {
+	case "message":
+		return StringObj{Value: e.Err.Message}
+	case "data":
+		return e.Err.Data
+	case "traceback":
+		return stringsToPack(e.Err.Traceback)
+	}
+	return NilObj
+}
+
+// 先经 __index 查找，找不到时再直接查元表本身
+func lookupMethod(in *Interpreter, receiver Object, name string) (Object, *EvalError) {
+	switch receiver.(type) {
+	case GeneratorObj, TaskObj, ChanObj, WaitGroupObj:
+		if method, _ := indexObj(in, receiver, StringObj{Value: name}); isCallable(method) {
+			return method, nil
+		}
+		return nil, &EvalError{Message: fmt.Sprintf("method %s not found on %s", name, receiver.Type())}
+	}
+	table, ok := receiver.(TableObj)
+	if !ok {
+		return nil, &EvalError{Message: fmt.Sprintf("method call %s on non table object %s", name, receiver.Type())}
+	}
+	key := StringObj{Value: name}
+	method, err := indexObj(in, table, key)
+	if err != nil {
+		return nil, err
+	}
+	if method == NilObj && table.Table.Meta != nil {
+		if m, ok := table.Table.Meta.Store[key]; ok {
+			method = m
+		}
+	}
+	if !isCallable(method) {
+		return nil, &EvalError{Message: fmt.Sprintf("method %s not found or not callable, got %s", name, method.Type())}
+	}
+	return method, nil
+}
+
+func setIndexObj(in *Interpreter, obj Object, index Object, value Object) *EvalError {
+	if err := checkTableKey(index); err != nil {
+		return err
+	}
+	for i := 0; i < maxMetaChain; i++ {
+		table, ok := obj.(TableObj)
+		if !ok {
+			return &EvalError{Message: "assign to an index of non table"}
+		}
+		_, exist := table.Table.Store[index]
+		h := getMetaMethod(table, "__newindex")
+		if exist || h == nil {
+			if table.Table.frozen {
+				return &EvalError{Message: "assign to an index of frozen table"}
+			}
+			table.Table.set(index, value)
+			return nil
+		}
+		if isCallable(h) {
+			_, err := callFunction(in, h, []Object{table, index, value})
+			return err
+		}
+		obj = h
+	}
+	return &EvalError{Message: "__newindex chain too long"}
+}
+
+func findBinaryMetaMethod(left Object, right Object, event string) Object {
+	if h := getMetaMethod(left, event); h != nil {
+		return h
+	}
+	return getMetaMethod(right, event)
+}
+
+// 返回值 ok 表示运算是否由元方法处理
+func metaArithInfix(in *Interpreter, op lexer.TokenType, left Object, right Object) (Object, bool, *EvalError) {
+	if left.Type() != TTableObj && right.Type() != TTableObj {
+		return nil, false, nil
+	}
+	callBinary := func(event string, a Object, b Object) (Object, bool, *EvalError) {
+		h := findBinaryMetaMethod(a, b, event)
+		if h == nil {
+			return nil, false, nil
+		}
+		res, err := callFunction(in, h, []Object{a, b})
+		return res, true, err
+	}
+	callCompare := func(event string, a Object, b Object, negate bool) (Object, bool, *EvalError) {
+		res, ok, err := callBinary(event, a, b)
+		if !ok || err != nil {
+			return nil, ok, err
+		}
+		return BooleanObj{Value: toBooleanObj(res).Value != negate}, true, nil
+	}
+
+	switch op {
+	case lexer.T_PLUS:
+		return callBinary("__add", left, right)
+	case lexer.T_MINUS:
+		return callBinary("__sub", left, right)
+	case lexer.T_ASTERISK:
+		return callBinary("__mul", left, right)
+	case lexer.T_SLASH:
+		return callBinary("__div", left, right)
+	case lexer.T_PERCENT:
+		return callBinary("__mod", left, right)
+	case lexer.T_POWER:
+		return callBinary("__pow", left, right)
+	case lexer.T_DOUBLE_SLASH:
+		return callBinary("__idiv", left, right)
+	case lexer.T_AMPERSAND:
+		return callBinary("__band", left, right)
+	case lexer.T_PIPE:
+		return callBinary("__bor", left, right)
+	case lexer.T_CARET:
+		return callBinary("__bxor", left, right)
+	case lexer.T_SHL:
+		return callBinary("__shl", left, right)
+	case lexer.T_SHR:
+		return callBinary("__shr", left, right)
+	case lexer.T_LT:
+		return callCompare("__lt", left, right, false)
+	case lexer.T_GT:
+		return callCompare("__lt", right, left, false)
+	case lexer.T_LE:
+		if res, ok, err := callCompare("__le", left, right, false); ok || err != nil {
+			return res, ok, err
+		}
+		return callCompare("__lt", right, left, true)
+	case lexer.T_GE:
+		if res, ok, err := callCompare("__le", right, left, false); ok || err != nil {
+			return res, ok, err
+		}
+		return callCompare("__lt", left, right, true)
+	case lexer.T_EQ, lexer.T_NEQ:
+		l, lok := left.(TableObj)
+		r, rok := right.(TableObj)
+		if !lok || !rok || l.Table == r.Table {
+			return nil, false, nil
+		}
+		return callCompare("__eq", left, right, op == lexer.T_NEQ)
+	}
+	return nil, false, nil
+}
+
+func metaArithPrefix(in *Interpreter, op lexer.TokenType, right Object) (Object, bool, *EvalError) {
+	var event string
+	switch op {
+	case lexer.T_MINUS:
+		event = "__unm"
+	case lexer.T_TILDE:
+		event = "__bnot"
+	default:
+		return nil, false, nil
+	}
+	h := getMetaMethod(right, event)
+	if h == nil {
+		return nil, false, nil
+	}
+	res, err := callFunction(in, h, []Object{right})
+	return res, true, err
+}
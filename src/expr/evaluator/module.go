@@ -0,0 +1,141 @@
+package evaluator
+
+import (
+	"bytes"
+	"expr/lexer"
+	"expr/parser"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+)
+
+// ModuleLoader 根据 import 的路径返回模块源码
+type ModuleLoader interface {
+	LoadModule(name string) ([]byte, error)
+}
+
+// FSLoader 从 fs.FS 加载模块，可用于 embed.FS
+type FSLoader struct {
+	FS fs.FS
+}
+
+func (l FSLoader) LoadModule(name string) ([]byte, error) {
+	return fs.ReadFile(l.FS, name)
+}
+
+// NewDirLoader 从 dir 目录下加载模块
+func NewDirLoader(dir string) FSLoader {
+	return FSLoader{FS: os.DirFS(dir)}
+}
+
+// MapLoader 从内存中加载模块，键为模块路径，值为源码
+type MapLoader map[string]string
+
+func (l MapLoader) LoadModule(name string) ([]byte, error) {
+	src, ok := l[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "import", Path: name, Err: fs.ErrNotExist}
+	}
+	return []byte(src), nil
+}
+
+func WithModuleLoader(loader ModuleLoader) Option {
+	return func(in *Interpreter) {
+		in.loader = loader
+	}
+}
+
+// 正在加载的模块。模块的顶层代码可能阻塞并释放 gil，
+// 此时其他任务 import 同一个模块会等待 done 关闭，而不是当作循环导入
+type moduleLoad struct {
+	task *task
+	done chan struct{}
+}
+
+// 模块在自己的环境中只执行一次，导出值被缓存。
+// 模块显式 return 非 nil 的值时导出该值，否则导出由顶层变量组成的表
+func evalImportExpr(expr *parser.ImportExpr, env *Environment) (Object, *EvalError) {
+	in := env.interp
+	if in == nil || in.loader == nil {
+		return nil, &EvalError{Message: fmt.Sprintf("import %q: no module loader", expr.Path)}
+	}
+	name := path.Clean(expr.Path)
+	if !fs.ValidPath(name) {
+		return nil, &EvalError{Message: fmt.Sprintf("import %q: invalid module path", expr.Path)}
+	}
+	if module, ok := in.modules[name]; ok {
+		return module, nil
+	}
+	t := in.task
+	if t == nil {
+		return nil, errNoTask("import")
+	}
+	for i, loading := range t.loading {
+		if loading == name {
+			chain := append(append([]string(nil), t.loading[i:]...), name)
+			return nil, &EvalError{Message: fmt.Sprintf("import cycle: %s", strings.Join(chain, " -> "))}
+		}
+	}
+	for load := in.loading[name]; load != nil; load = in.loading[name] {
+		// 等待关系回到当前任务时，两个任务互相等待对方加载的模块
+		for owner := load.task; owner != nil; {
+			if owner == t {
+				return nil, &EvalError{Message: fmt.Sprintf("import cycle: %s is imported by a task waiting for this one", name)}
+			}
+			next := in.loading[owner.waiting]
+			if next == nil {
+				break
+			}
+			owner = next.task
+		}
+		t.waiting = name
+		in.Blocking(func() { <-load.done })
+		t.waiting = ""
+		// 加载失败时模块没有被缓存，由当前任务重新加载
+		if module, ok := in.modules[name]; ok {
+			return module, nil
+		}
+	}
+
+	src, e := in.loader.LoadModule(name)
+	if e != nil {
+		return nil, &EvalError{Message: fmt.Sprintf("import %q: %s", name, e.Error())}
+	}
+	p := parser.New(lexer.New(bytes.NewReader(src)))
+	program := p.ParseProgram()
+	if len(p.Errors) != 0 {
+		msgs := make([]string, 0, len(p.Errors))
+		for _, err := range p.Errors {
+			msgs = append(msgs, err.Error())
+		}
+		return nil, &EvalError{Message: fmt.Sprintf("import %q: %s", name, strings.Join(msgs, "; "))}
+	}
+
+	load := &moduleLoad{task: t, done: make(chan struct{})}
+	in.loading[name] = load
+	t.loading = append(t.loading, name)
+	defer func() {
+		t.loading = t.loading[:len(t.loading)-1]
+		delete(in.loading, name)
+		close(load.done)
+	}()
+	moduleEnv := NewInnerEnv(in.globals)
+	obj, err := evalFuncBlockExpr(program, moduleEnv)
+	if err != nil {
+		// 保留 throw 的值和调用栈，只给信息加上模块名
+		wrapped := *err
+		wrapped.Message = fmt.Sprintf("import %q: %s", name, err.Message)
+		return nil, &wrapped
+	}
+	if obj == NilObj {
+		exports := newTable()
+		for k, v := range moduleEnv.LocalVars {
+			exports.Table.Store[StringObj{Value: k}] = *v
+		}
+		obj = exports
+	}
+	in.modules[name] = obj
+	return obj, nil
+}
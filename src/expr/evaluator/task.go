@@ -0,0 +1,182 @@
+package evaluator
+
+import (
+	"fmt"
+)
+
+// task 是一条独立的求值流程：Run 运行的脚本或 spawn 启动的函数。
+// 所有任务共享解释器的 gil，只有持有 gil 的任务在求值，因此捕获的变量和表不会被并发读写；
+// await、通道收发等阻塞操作通过 Blocking 释放 gil，让其他任务运行。
+// in.task 只在持有 gil 时不为 nil，释放 gil 之前置为 nil
+type task struct {
+	in         *Interpreter
+	coroutines []*coroutine // 任务中正在运行的协程，栈顶是当前协程
+	loading    []string     // 任务正在加载的模块，栈顶是最内层的 import，用于检测循环导入
+	waiting    string       // 任务正在等待其他任务加载的模块
+
+	done   chan struct{}
+	result Object
+	err    *EvalError
+}
+
+// Blocking 在释放 gil 的情况下执行 fn，用于原生函数中耗时的宿主调用，
+// 使 spawn 出的多个任务可以并行等待。fn 中不能读写脚本的对象。
+// 没有任务持有 gil 时（宿主不经过 Run 或 Call 直接调用原生函数）直接执行 fn
+func (in *Interpreter) Blocking(fn func()) {
+	t := in.task
+	if t == nil {
+		fn()
+		return
+	}
+	in.task = nil
+	in.gil.Unlock()
+	defer func() {
+		in.gil.Lock()
+		in.task = t
+	}()
+	fn()
+}
+
+// BindBlockingFunc 注册在 Blocking 中执行的原生函数，参数在释放 gil 之前已经求值
+func (in *Interpreter) BindBlockingFunc(name string, fn NativeFunc) {
+	in.BindFunc(name, func(args []Object) (obj Object, err *EvalError) {
+		in.Blocking(func() { obj, err = fn(args) })
+		return
+	})
+}
+
+// 宿主不经过 Run 或 Call 调用了需要任务的原生函数
+func errNoTask(name string) *EvalError {
+	return &EvalError{Message: fmt.Sprintf("%s: no running task, call it through Interpreter.Run or Interpreter.Call", name)}
+}
+
+// spawn(fn, args...) 在新的 goroutine 中调用 fn，返回任务句柄
+func (in *Interpreter) spawn(args []Object) (Object, *EvalError) {
+	fn, err := argCallable("spawn", args, 0)
+	if err != nil {
+		return nil, err
+	}
+	fnArgs := append([]Object(nil), args[1:]...)
+	t := &task{in: in, done: make(chan struct{})}
+	go func() {
+		defer close(t.done)
+		in.gil.Lock()
+		defer in.gil.Unlock()
+		in.task = t
+		defer func() {
+			in.task = nil
+			if r := recover(); r != nil {
+				t.result, t.err = NilObj, &EvalError{Message: fmt.Sprintf("task panic: %v", r)}
+			}
+		}()
+		t.result, t.err = callFunction(in, fn, fnArgs)
+	}()
+	return TaskObj{Task: &TaskValue{t: t}}, nil
+}
+
+// await(task) 等待任务结束并返回其结果，任务中的错误由 await 抛出
+func awaitTask(args []Object) (Object, *EvalError) {
+	if len(args) == 0 {
+		return nil, argMissingError("await", 0, "task")
+	}
+	handle, ok := args[0].(TaskObj)
+	if !ok {
+		return nil, argTypeError("await", 0, "task", args[0])
+	}
+	return handle.Task.t.wait()
+}
+
+func (t *task) wait() (Object, *EvalError) {
+	t.in.Blocking(func() { <-t.done })
+	if t.err != nil {
+		return nil, t.err
+	}
+	return t.result, nil
+}
+
+// 任务的字段：await() 等价于 await(task)，done 表示任务是否已经结束
+func indexTaskObj(o TaskObj, index Object) Object {
+	key, _ := index.(StringObj)
+	switch key.Value {
+	case "await":
+		return NewNativeFunc("task.await", func(args []Object) (Object, *EvalError) {
+			return o.Task.t.wait()
+		})
+	case "done":
+		select {
+		case <-o.Task.t.done:
+			return BooleanObj{Value: true}
+		default:
+			return BooleanObj{Value: false}
+		}
+	}
+	return NilObj
+}
+
+// waitgroup() 创建等待组，用于等待一组任务结束
+func (in *Interpreter) newWaitGroup(args []Object) (Object, *EvalError) {
+	zero := make(chan struct{})
+	close(zero)
+	return WaitGroupObj{WaitGroup: &WaitGroupValue{in: in, zero: zero}}, nil
+}
+
+func (wg *WaitGroupValue) add(delta int64) *EvalError {
+	wg.mu.Lock()
+	defer wg.mu.Unlock()
+	if wg.n+delta < 0 {
+		return &EvalError{Message: "negative waitgroup counter"}
+	}
+	if wg.n == 0 && delta > 0 {
+		wg.zero = make(chan struct{})
+	}
+	wg.n += delta
+	if wg.n == 0 && delta < 0 {
+		close(wg.zero)
+	}
+	return nil
+}
+
+// wait 释放 gil 直到计数为 0
+func (wg *WaitGroupValue) wait() {
+	wg.mu.Lock()
+	zero := wg.zero
+	wg.mu.Unlock()
+	wg.in.Blocking(func() { <-zero })
+}
+
+// 等待组的字段：add([n]) 计数加 n，n 默认为 1；done() 计数减 1；wait() 等待计数变为 0
+func indexWaitGroupObj(o WaitGroupObj, index Object) Object {
+	key, _ := index.(StringObj)
+	// 以方法调用时第一个参数是等待组自身
+	stripSelf := func(args []Object) []Object {
+		if len(args) != 0 && args[0] == o {
+			return args[1:]
+		}
+		return args
+	}
+	switch key.Value {
+	case "add":
+		return NewNativeFunc("waitgroup.add", func(args []Object) (Object, *EvalError) {
+			args = stripSelf(args)
+			delta := int64(1)
+			if hasArg(args, 0) {
+				n, err := argInteger("waitgroup.add", args, 0)
+				if err != nil {
+					return nil, err
+				}
+				delta = n
+			}
+			return NilObj, o.WaitGroup.add(delta)
+		})
+	case "done":
+		return NewNativeFunc("waitgroup.done", func(args []Object) (Object, *EvalError) {
+			return NilObj, o.WaitGroup.add(-1)
+		})
+	case "wait":
+		return NewNativeFunc("waitgroup.wait", func(args []Object) (Object, *EvalError) {
+			o.WaitGroup.wait()
+			return NilObj, nil
+		})
+	}
+	return NilObj
+}
@@ -3,22 +3,44 @@ package lexer
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
+// 输入按 UTF-8 解码，列号按 rune 计数，从 1 开始
 type Lexer struct {
 	reader *bufio.Reader
 	line   int
+	column int
+
+	tokenLine   int
+	tokenColumn int
+	lastType    TokenType // 上一个 token 的类型
 }
 
+// peekChar/readChar 遇到非法 UTF-8 字节时返回 invalidChar
+const invalidChar rune = -1
+
 func New(reader io.Reader) *Lexer {
-	return &Lexer{reader: bufio.NewReader(reader), line: 1}
+	return &Lexer{reader: bufio.NewReader(reader), line: 1, column: 1}
+}
+
+// 从指定位置开始计数行列号，用于解析插值字符串中的表达式
+func NewAt(reader io.Reader, line int, column int) *Lexer {
+	return &Lexer{reader: bufio.NewReader(reader), line: line, column: column}
 }
 
 func (l *Lexer) NextToken() *Token {
 	l.skipBlank()
+	l.tokenLine, l.tokenColumn = l.line, l.column
 	c := l.peekChar()
 	switch c {
+	case invalidChar:
+		l.readChar()
+		return l.newToken(T_ILLEGAL, "invalid UTF-8 encoding")
 	case 0:
 		l.readChar()
 		return l.newToken(T_EOF, "EOF")
@@ -30,16 +52,68 @@ func (l *Lexer) NextToken() *Token {
 		return l.newToken(T_SEMICOLON, "")
 	case '+':
 		l.readChar()
-		return l.newToken(T_PLUS, "")
+		if l.peekChar() == '+' {
+			l.readChar()
+			return l.newToken(T_INC, "")
+		} else if l.peekChar() == '=' {
+			l.readChar()
+			return l.newToken(T_PLUS_ASSIGN, "")
+		} else {
+			return l.newToken(T_PLUS, "")
+		}
 	case '-':
 		l.readChar()
-		return l.newToken(T_MINUS, "")
+		if l.peekChar() == '-' && !(l.afterOperand() && startsOperand(l.peekSecondChar())) {
+			l.readChar()
+			return l.newToken(T_DEC, "")
+		} else if l.peekChar() == '=' {
+			l.readChar()
+			return l.newToken(T_MINUS_ASSIGN, "")
+		} else {
+			return l.newToken(T_MINUS, "")
+		}
 	case '*':
 		l.readChar()
-		return l.newToken(T_ASTERISK, "")
+		if l.peekChar() == '*' {
+			l.readChar()
+			return l.newToken(T_POWER, "")
+		} else if l.peekChar() == '=' {
+			l.readChar()
+			return l.newToken(T_ASTERISK_ASSIGN, "")
+		} else {
+			return l.newToken(T_ASTERISK, "")
+		}
 	case '/':
 		l.readChar()
-		return l.newToken(T_SLASH, "")
+		if l.peekChar() == '/' {
+			l.readChar()
+			return l.newToken(T_DOUBLE_SLASH, "")
+		} else if l.peekChar() == '=' {
+			l.readChar()
+			return l.newToken(T_SLASH_ASSIGN, "")
+		} else {
+			return l.newToken(T_SLASH, "")
+		}
+	case '%':
+		l.readChar()
+		if l.peekChar() == '=' {
+			l.readChar()
+			return l.newToken(T_PERCENT_ASSIGN, "")
+		} else {
+			return l.newToken(T_PERCENT, "")
+		}
+	case '&':
+		l.readChar()
+		return l.newToken(T_AMPERSAND, "")
+	case '|':
+		l.readChar()
+		return l.newToken(T_PIPE, "")
+	case '^':
+		l.readChar()
+		return l.newToken(T_CARET, "")
+	case '~':
+		l.readChar()
+		return l.newToken(T_TILDE, "")
 	case '(':
 		l.readChar()
 		return l.newToken(T_LPAREN, "")
@@ -63,7 +137,14 @@ func (l *Lexer) NextToken() *Token {
 	case '.':
 		l.readChar()
 		if isNumber(l.peekChar()) {
-			return l.readFloat("0")
+			return l.readFloat(bytes.NewBufferString("."), "0")
+		} else if l.peekChar() == '.' {
+			l.readChar()
+			if l.peekChar() != '.' {
+				return l.newToken(T_ILLEGAL, "unexpected \"..\"")
+			}
+			l.readChar()
+			return l.newToken(T_ELLIPSIS, "")
 		} else {
 			return l.newToken(T_DOT, "")
 		}
@@ -88,6 +169,9 @@ func (l *Lexer) NextToken() *Token {
 		if l.peekChar() == '=' {
 			l.readChar()
 			return l.newToken(T_LE, "")
+		} else if l.peekChar() == '<' {
+			l.readChar()
+			return l.newToken(T_SHL, "")
 		} else {
 			return l.newToken(T_LT, "")
 		}
@@ -96,6 +180,9 @@ func (l *Lexer) NextToken() *Token {
 		if l.peekChar() == '=' {
 			l.readChar()
 			return l.newToken(T_GE, "")
+		} else if l.peekChar() == '>' {
+			l.readChar()
+			return l.newToken(T_SHR, "")
 		} else {
 			return l.newToken(T_GT, "")
 		}
@@ -114,82 +201,245 @@ func (l *Lexer) NextToken() *Token {
 			return l.readWord()
 		}
 		l.readChar()
-		return l.newToken(T_ILLEGAL, "")
+		return l.newToken(T_ILLEGAL, fmt.Sprintf("unexpected character %q", c))
 	}
 }
 
 func (l *Lexer) newToken(t TokenType, message string) *Token {
-	return &Token{Type: t, Line: l.line, Message: message}
+	l.lastType = t
+	return &Token{Type: t, Line: l.tokenLine, Column: l.tokenColumn, Message: message}
 }
 
+// '//' 是整除运算符，所以注释使用 '#'，直到行尾
 func (l *Lexer) skipBlank() {
-	for c := l.peekChar(); c != 0 && c <= 32; c = l.peekChar() {
-		if l.readChar() == '\n' {
-			l.line++
+	for c := l.peekChar(); c > 0 && (c <= 32 || unicode.IsSpace(c) || c == '#'); c = l.peekChar() {
+		if c == '#' {
+			for c := l.peekChar(); c != 0 && c != '\n'; c = l.peekChar() {
+				l.readChar()
+			}
+		} else {
+			l.readChar()
 		}
 	}
 }
 
-func (l *Lexer) peekChar() byte {
-	b, err := l.reader.Peek(1)
-	if err == io.EOF {
+func (l *Lexer) peekChar() rune {
+	r, size, err := l.reader.ReadRune()
+	if err != nil {
 		return 0
 	}
-	return b[0]
+	_ = l.reader.UnreadRune()
+	if r == utf8.RuneError && size == 1 {
+		return invalidChar
+	}
+	return r
 }
 
-func (l *Lexer) readChar() byte {
-	b, err := l.reader.ReadByte()
-	if err == io.EOF {
+// 返回 peekChar 之后的下一个字符
+func (l *Lexer) peekSecondChar() rune {
+	bs, _ := l.reader.Peek(1 + utf8.UTFMax)
+	if len(bs) == 0 {
+		return 0
+	}
+	_, size := utf8.DecodeRune(bs)
+	if len(bs) <= size {
 		return 0
 	}
-	return b
+	r, size := utf8.DecodeRune(bs[size:])
+	if r == utf8.RuneError && size == 1 {
+		return invalidChar
+	}
+	return r
+}
+
+// 上一个 token 是否能结束一个操作数，此时 '-' 应当是二元减号
+func (l *Lexer) afterOperand() bool {
+	switch l.lastType {
+	case T_IDENT, T_INT, T_FLOAT, T_STRING, T_INTERP_STRING, T_TRUE, T_FALSE, T_NIL,
+		T_RPAREN, T_RBRACKET, T_RBRACE:
+		return true
+	}
+	return false
+}
+
+// a--b 是 a - (-b)，只有 '--' 后面不紧跟操作数时才是自减
+func startsOperand(c rune) bool {
+	return isNumber(c) || isLetter(c) || c == '(' || c == '[' || c == '"' || c == '!' || c == '~'
+}
+
+func (l *Lexer) readChar() rune {
+	r, size, err := l.reader.ReadRune()
+	if err != nil {
+		return 0
+	}
+	if r == '\n' {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
+	if r == utf8.RuneError && size == 1 {
+		return invalidChar
+	}
+	return r
 }
 
-func isNumber(c byte) bool {
+func isNumber(c rune) bool {
 	return c >= '0' && c <= '9'
 }
 
+func isHexNumber(c rune) bool {
+	return isNumber(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isOctNumber(c rune) bool {
+	return c >= '0' && c <= '7'
+}
+
+func isBinNumber(c rune) bool {
+	return c == '0' || c == '1'
+}
+
+// 数字字面量: 123 1_000 0x1F 0o17 0b101 1.5 .5 1. 1e-9 2.5E3
+// Message 中去掉了下划线。十进制整数不能有前导 0，避免 0755 被误当作八进制
 func (l *Lexer) readNumber() *Token {
 	buf := bytes.Buffer{}
-	for {
-		c := l.peekChar()
-		if c == '.' {
-			l.readChar()
-			return l.readFloat(buf.String())
-		} else if isNumber(c) {
-			buf.WriteByte(l.readChar())
-		} else {
-			break
+	if l.peekChar() == '0' {
+		buf.WriteRune(l.readChar())
+		var isDigit func(rune) bool
+		switch l.peekChar() {
+		case 'x', 'X':
+			isDigit = isHexNumber
+		case 'o', 'O':
+			isDigit = isOctNumber
+		case 'b', 'B':
+			isDigit = isBinNumber
+		}
+		if isDigit != nil {
+			buf.WriteRune(l.readChar())
+			digits := l.readDigits(&buf, isDigit)
+			if digits == "" {
+				return l.malformedNumber(&buf)
+			}
+			return l.finishNumber(&buf, T_INT, buf.String()[:2]+digits)
 		}
 	}
-	s := buf.String()
-	if s == "" {
-		s = "0"
+	leadingZero := buf.String()
+	intPart := l.readDigits(&buf, isNumber)
+	if intPart == "" && buf.Len() > len(leadingZero) {
+		return l.malformedNumber(&buf)
+	}
+	intPart = leadingZero + intPart
+	if l.peekChar() == '.' {
+		buf.WriteRune(l.readChar())
+		return l.readFloat(&buf, intPart)
 	}
-	return l.newToken(T_INT, s)
+	if c := l.peekChar(); c == 'e' || c == 'E' {
+		return l.readExponent(&buf, intPart)
+	}
+	if len(intPart) > 1 && intPart[0] == '0' {
+		return l.malformedNumber(&buf)
+	}
+	return l.finishNumber(&buf, T_INT, intPart)
 }
 
-func (l *Lexer) readFloat(intPart string) *Token {
-	decimal := l.readNumber()
-	if decimal.Type == T_INT {
-		return l.newToken(T_FLOAT, intPart+"."+decimal.Message)
+// buf 中已经读入了整数部分和小数点
+func (l *Lexer) readFloat(buf *bytes.Buffer, intPart string) *Token {
+	if intPart == "" {
+		intPart = "0"
+	}
+	decimal := ""
+	if isNumber(l.peekChar()) {
+		decimal = l.readDigits(buf, isNumber)
+		if decimal == "" {
+			return l.malformedNumber(buf)
+		}
+	} else if l.peekChar() == '_' {
+		return l.malformedNumber(buf)
 	} else {
-		return l.newToken(T_ILLEGAL, intPart+"."+decimal.Message)
+		decimal = "0"
 	}
+	if c := l.peekChar(); c == 'e' || c == 'E' {
+		return l.readExponent(buf, intPart+"."+decimal)
+	}
+	return l.finishNumber(buf, T_FLOAT, intPart+"."+decimal)
 }
 
-func isLetter(c byte) bool {
-	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
+func (l *Lexer) readExponent(buf *bytes.Buffer, mantissa string) *Token {
+	buf.WriteRune(l.readChar())
+	sign := ""
+	if c := l.peekChar(); c == '+' || c == '-' {
+		buf.WriteRune(l.readChar())
+		sign = string(c)
+	}
+	if !isNumber(l.peekChar()) {
+		return l.malformedNumber(buf)
+	}
+	exponent := l.readDigits(buf, isNumber)
+	if exponent == "" {
+		return l.malformedNumber(buf)
+	}
+	return l.finishNumber(buf, T_FLOAT, mantissa+"e"+sign+exponent)
+}
+
+// 读入数字和分隔符 '_'，返回去掉分隔符的数字；'_' 不在两个数字之间时返回空串
+func (l *Lexer) readDigits(buf *bytes.Buffer, isDigit func(rune) bool) string {
+	digits := bytes.Buffer{}
+	valid := true
+	for c := l.peekChar(); isDigit(c) || c == '_'; c = l.peekChar() {
+		if c == '_' {
+			b := buf.Bytes()
+			afterPrefix := len(b) == 2 && b[0] == '0' && strings.IndexByte("xXoObB", b[1]) >= 0
+			if len(b) == 0 || (!isHexNumber(rune(b[len(b)-1])) && !afterPrefix) {
+				valid = false
+			}
+			buf.WriteRune(l.readChar())
+		} else {
+			buf.WriteRune(l.readChar())
+			digits.WriteRune(c)
+		}
+	}
+	if b := buf.Bytes(); !valid || (len(b) > 0 && b[len(b)-1] == '_') {
+		return ""
+	}
+	return digits.String()
+}
+
+// 数字后紧跟字母、数字或 '.' 时整个字面量非法，例如 1.2.3 0xZZ 0b102 12abc
+func (l *Lexer) finishNumber(buf *bytes.Buffer, t TokenType, message string) *Token {
+	if c := l.peekChar(); isLetter(c) || isNumber(c) || c == '.' {
+		return l.malformedNumber(buf)
+	}
+	return l.newToken(t, message)
+}
+
+func (l *Lexer) malformedNumber(buf *bytes.Buffer) *Token {
+	for c := l.peekChar(); isLetter(c) || isNumber(c) || c == '.'; c = l.peekChar() {
+		buf.WriteRune(l.readChar())
+	}
+	return l.newToken(T_ILLEGAL, "malformed number literal "+buf.String())
+}
+
+func isLetter(c rune) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_' ||
+		(c >= utf8.RuneSelf && unicode.IsLetter(c))
+}
+
+func isIdentDigit(c rune) bool {
+	return isNumber(c) || (c >= utf8.RuneSelf && unicode.IsDigit(c))
 }
 
 func (l *Lexer) readWord() *Token {
 	buf := bytes.Buffer{}
-	for c := l.peekChar(); isLetter(c) || isNumber(c); c = l.peekChar() {
-		buf.WriteByte(l.readChar())
+	for c := l.peekChar(); isLetter(c) || isIdentDigit(c); c = l.peekChar() {
+		buf.WriteRune(l.readChar())
 	}
 	s := buf.String()
 	t := keywordOrIdent(s)
+	// '.' 和 ':' 之后是字段名或方法名，关键字也作为标识符，例如 coroutine.yield
+	if l.lastType == T_DOT || l.lastType == T_COLON {
+		t = T_IDENT
+	}
 	message := ""
 	if t == T_IDENT {
 		message = s
@@ -197,12 +447,86 @@ func (l *Lexer) readWord() *Token {
 	return l.newToken(t, message)
 }
 
+// 字符串中 ${expr} 为插值表达式，\$ 表示字面的 $
 func (l *Lexer) readString() *Token {
 	l.readChar()
 	buf := bytes.Buffer{}
-	for l.peekChar() != '"' {
-		buf.WriteByte(l.readChar())
+	var parts []StringPart
+	invalid := false
+	for c := l.peekChar(); c != '"'; c = l.peekChar() {
+		switch c {
+		case 0:
+			return l.newToken(T_ILLEGAL, "unterminated string literal")
+		case invalidChar:
+			invalid = true
+		case '\\':
+			l.readChar()
+			if l.peekChar() == '$' {
+				buf.WriteRune(l.readChar())
+			} else {
+				buf.WriteRune('\\')
+			}
+			continue
+		case '$':
+			line, column := l.line, l.column
+			l.readChar()
+			if l.peekChar() != '{' {
+				buf.WriteRune('$')
+				continue
+			}
+			l.readChar()
+			parts = append(parts, StringPart{IsExpr: false, Text: buf.String()})
+			buf.Reset()
+			expr, ok := l.readInterpolation()
+			if !ok {
+				return l.newToken(T_ILLEGAL, "unterminated ${ in string literal")
+			}
+			if strings.TrimSpace(expr) == "" {
+				return l.newToken(T_ILLEGAL, "empty ${} in string literal")
+			}
+			parts = append(parts, StringPart{IsExpr: true, Text: expr, Line: line, Column: column + 2})
+			continue
+		}
+		buf.WriteRune(l.readChar())
 	}
 	l.readChar()
-	return l.newToken(T_STRING, buf.String())
+	if invalid {
+		return l.newToken(T_ILLEGAL, "invalid UTF-8 encoding in string literal")
+	}
+	if parts == nil {
+		return l.newToken(T_STRING, buf.String())
+	}
+	parts = append(parts, StringPart{IsExpr: false, Text: buf.String()})
+	token := l.newToken(T_INTERP_STRING, "")
+	token.Parts = parts
+	return token
+}
+
+// 读取 ${ 之后到匹配的 } 为止的表达式源码，跳过其中嵌套的字符串和 {}
+func (l *Lexer) readInterpolation() (string, bool) {
+	buf := bytes.Buffer{}
+	depth := 0
+	for {
+		c := l.readChar()
+		switch c {
+		case 0:
+			return "", false
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return buf.String(), true
+			}
+			depth--
+		case '"':
+			buf.WriteRune(c)
+			for c = l.readChar(); c != '"'; c = l.readChar() {
+				if c == 0 {
+					return "", false
+				}
+				buf.WriteRune(c)
+			}
+		}
+		buf.WriteRune(c)
+	}
 }
@@ -2,6 +2,7 @@ package lexer
 
 import (
 	"bytes"
+	"fmt"
 	"testing"
 )
 
@@ -36,6 +37,9 @@ t:method(1,2,3)
 hello
 hello_23_world
 "hello"
+% ** // & | ^ ~ << >> # comment ** //
+x//y # x // y
+x += 1 -= *= /= %= ++ --
 `
 	expect := `T_IDENT line: 2; int;
 T_DECLARATION line: 2; ;
@@ -141,7 +145,28 @@ T_DECLARATION line: 26; ;
 T_IDENT line: 28; hello;
 T_IDENT line: 29; hello_23_world;
 T_STRING line: 30; hello;
-T_EOF line: 31; EOF;
+T_PERCENT line: 31; ;
+T_POWER line: 31; ;
+T_DOUBLE_SLASH line: 31; ;
+T_AMPERSAND line: 31; ;
+T_PIPE line: 31; ;
+T_CARET line: 31; ;
+T_TILDE line: 31; ;
+T_SHL line: 31; ;
+T_SHR line: 31; ;
+T_IDENT line: 32; x;
+T_DOUBLE_SLASH line: 32; ;
+T_IDENT line: 32; y;
+T_IDENT line: 33; x;
+T_PLUS_ASSIGN line: 33; ;
+T_INT line: 33; 1;
+T_MINUS_ASSIGN line: 33; ;
+T_ASTERISK_ASSIGN line: 33; ;
+T_SLASH_ASSIGN line: 33; ;
+T_PERCENT_ASSIGN line: 33; ;
+T_INC line: 33; ;
+T_DEC line: 33; ;
+T_EOF line: 34; EOF;
 `
 	buf := bytes.NewBufferString(input)
 	output := bytes.Buffer{}
@@ -158,3 +183,160 @@ T_EOF line: 31; EOF;
 		t.Error(output.String())
 	}
 }
+
+func TestNumberLiteral(t *testing.T) {
+	tests := []struct {
+		input   string
+		tt      TokenType
+		message string
+	}{
+		{"0", T_INT, "0"},
+		{"0012", T_ILLEGAL, "malformed number literal 0012"},
+		{"0755", T_ILLEGAL, "malformed number literal 0755"},
+		{"08", T_ILLEGAL, "malformed number literal 08"},
+		{"0_1", T_ILLEGAL, "malformed number literal 0_1"},
+		{"0.5", T_FLOAT, "0.5"},
+		{"0e3", T_FLOAT, "0e3"},
+		{"1_000_000", T_INT, "1000000"},
+		{"0x1F", T_INT, "0x1F"},
+		{"0XfF_ff", T_INT, "0XfFff"},
+		{"0x_1f", T_INT, "0x1f"},
+		{"0o17", T_INT, "0o17"},
+		{"0b1010_1010", T_INT, "0b10101010"},
+		{"1.5", T_FLOAT, "1.5"},
+		{"1_000.000_1", T_FLOAT, "1000.0001"},
+		{".5", T_FLOAT, "0.5"},
+		{"5.", T_FLOAT, "5.0"},
+		{"1e-9", T_FLOAT, "1e-9"},
+		{"2.5E3", T_FLOAT, "2.5e3"},
+		{"1e+10", T_FLOAT, "1e+10"},
+		{"1.2.3", T_ILLEGAL, "malformed number literal 1.2.3"},
+		{"0xZZ", T_ILLEGAL, "malformed number literal 0xZZ"},
+		{"0b102", T_ILLEGAL, "malformed number literal 0b102"},
+		{"0o8", T_ILLEGAL, "malformed number literal 0o8"},
+		{"12abc", T_ILLEGAL, "malformed number literal 12abc"},
+		{"1__0", T_ILLEGAL, "malformed number literal 1__0"},
+		{"1_", T_ILLEGAL, "malformed number literal 1_"},
+		{"1._5", T_ILLEGAL, "malformed number literal 1._5"},
+		{"1e", T_ILLEGAL, "malformed number literal 1e"},
+		{"1e+", T_ILLEGAL, "malformed number literal 1e+"},
+	}
+	for _, test := range tests {
+		l := New(bytes.NewBufferString(test.input))
+		token := l.NextToken()
+		if token.Type != test.tt || token.Message != test.message {
+			t.Errorf("input %s: expect %s %s, got %s", test.input, test.tt, test.message, token.String())
+		}
+		if next := l.NextToken(); next.Type != T_EOF {
+			t.Errorf("input %s: expect EOF after literal, got %s", test.input, next.String())
+		}
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	input := "名字 := \"张三\"\n  年龄２ := 18 # 注释\nπ\u3000+ x１"
+	expect := `T_IDENT line: 1; 名字; 1
+T_DECLARATION line: 1; ; 4
+T_STRING line: 1; 张三; 7
+T_IDENT line: 2; 年龄２; 3
+T_DECLARATION line: 2; ; 7
+T_INT line: 2; 18; 10
+T_IDENT line: 3; π; 1
+T_PLUS line: 3; ; 3
+T_IDENT line: 3; x１; 5
+T_EOF line: 3; EOF; 7
+`
+	output := bytes.Buffer{}
+	l := New(bytes.NewBufferString(input))
+	for {
+		tok := l.NextToken()
+		output.WriteString(fmt.Sprintf("%s %d\n", tok.String(), tok.Column))
+		if tok.Type == T_EOF {
+			break
+		}
+	}
+	if output.String() != expect {
+		t.Errorf("Lexer unicode ouput error")
+		t.Error(output.String())
+	}
+}
+
+func TestIllegalInput(t *testing.T) {
+	tests := []struct {
+		input   string
+		message string
+	}{
+		{"\xff", "invalid UTF-8 encoding"},
+		{"\"abc\xfe\"", "invalid UTF-8 encoding in string literal"},
+		{"\"abc", "unterminated string literal"},
+		{"，", "unexpected character '，'"},
+		{"$", "unexpected character '$'"},
+		{"..x", "unexpected \"..\""},
+	}
+	for _, test := range tests {
+		token := New(bytes.NewBufferString(test.input)).NextToken()
+		if token.Type != T_ILLEGAL || token.Message != test.message {
+			t.Errorf("input %q: expect illegal %s, got %s", test.input, test.message, token.String())
+		}
+	}
+}
+
+func TestInterpolatedString(t *testing.T) {
+	token := New(bytes.NewBufferString(`"a ${x.y} b ${ f("}") }"`)).NextToken()
+	if token.Type != T_INTERP_STRING {
+		t.Fatalf("expect T_INTERP_STRING, got %s", token.String())
+	}
+	expect := []StringPart{
+		{IsExpr: false, Text: "a "},
+		{IsExpr: true, Text: "x.y", Line: 1, Column: 6},
+		{IsExpr: false, Text: " b "},
+		{IsExpr: true, Text: ` f("}") `, Line: 1, Column: 15},
+		{IsExpr: false, Text: ""},
+	}
+	if len(token.Parts) != len(expect) {
+		t.Fatalf("expect %d parts, got %v", len(expect), token.Parts)
+	}
+	for i, part := range token.Parts {
+		if part != expect[i] {
+			t.Errorf("part %d: expect %v, got %v", i, expect[i], part)
+		}
+	}
+	for _, input := range []string{`"${a"`, `"${}"`} {
+		if token := New(bytes.NewBufferString(input)).NextToken(); token.Type != T_ILLEGAL {
+			t.Errorf("input %s: expect T_ILLEGAL, got %s", input, token.String())
+		}
+	}
+}
+
+func TestKeywordField(t *testing.T) {
+	l := New(bytes.NewBufferString(`co.yield g:next x.if yield ...rest`))
+	expect := []string{"T_IDENT co", "T_DOT ", "T_IDENT yield", "T_IDENT g", "T_COLON ", "T_IDENT next",
+		"T_IDENT x", "T_DOT ", "T_IDENT if", "T_YIELD ", "T_ELLIPSIS ", "T_IDENT rest"}
+	for _, e := range expect {
+		token := l.NextToken()
+		if got := token.Type.String() + " " + token.Message; got != e {
+			t.Errorf("expect %s, got %s", e, got)
+		}
+	}
+}
+
+func TestDecrementBeforeOperand(t *testing.T) {
+	tests := []struct {
+		input  string
+		expect []string
+	}{
+		{"a--b", []string{"T_IDENT", "T_MINUS", "T_MINUS", "T_IDENT"}},
+		{"1--(2)", []string{"T_INT", "T_MINUS", "T_MINUS", "T_LPAREN", "T_INT", "T_RPAREN"}},
+		{"a--;", []string{"T_IDENT", "T_DEC", "T_SEMICOLON"}},
+		{"a-- b", []string{"T_IDENT", "T_DEC", "T_IDENT"}},
+		{"--a", []string{"T_DEC", "T_IDENT"}},
+	}
+	for _, tt := range tests {
+		l := New(bytes.NewBufferString(tt.input))
+		for _, e := range tt.expect {
+			if got := l.NextToken().Type.String(); got != e {
+				t.Errorf("input %s: expect %s, got %s", tt.input, e, got)
+			}
+		}
+	}
+}
@@ -7,7 +7,17 @@ type TokenType int
 type Token struct {
 	Type    TokenType
 	Line    int
+	Column  int
 	Message string
+	Parts   []StringPart // T_INTERP_STRING 的各个部分
+}
+
+// 插值字符串 "a ${expr} b" 的一个部分，IsExpr 为 true 时 Text 是表达式源码
+type StringPart struct {
+	IsExpr bool
+	Text   string
+	Line   int
+	Column int
 }
 
 func (t *Token) String() string {
@@ -27,12 +37,14 @@ const (
 	T_INT
 	T_FLOAT
 	T_STRING
+	T_INTERP_STRING
 	T_TABLE
 
 	T_COMMA
 	T_SEMICOLON
 	T_DOT
 	T_COLON
+	T_ELLIPSIS
 
 	T_ASSIGN
 	T_PLUS
@@ -40,6 +52,15 @@ const (
 	T_ASTERISK
 	T_SLASH
 	T_BANG
+	T_PERCENT
+	T_POWER
+	T_DOUBLE_SLASH
+	T_AMPERSAND
+	T_PIPE
+	T_CARET
+	T_TILDE
+	T_SHL
+	T_SHR
 
 	T_LT
 	T_LE
@@ -56,6 +77,13 @@ const (
 	T_RBRACE
 
 	T_DECLARATION
+	T_PLUS_ASSIGN
+	T_MINUS_ASSIGN
+	T_ASTERISK_ASSIGN
+	T_SLASH_ASSIGN
+	T_PERCENT_ASSIGN
+	T_INC
+	T_DEC
 
 	T_FUNCTION
 	T_TRUE
@@ -69,6 +97,13 @@ const (
 	T_RETURN
 	T_AND
 	T_OR
+	T_IMPORT
+	T_THROW
+	T_TRY
+	T_CATCH
+	T_DEFER
+	T_YIELD
+	T_IN
 )
 
 func (t TokenType) String() string {
@@ -87,6 +122,8 @@ func (t TokenType) String() string {
 		return "T_FLOAT"
 	case T_STRING:
 		return "T_STRING"
+	case T_INTERP_STRING:
+		return "T_INTERP_STRING"
 	case T_TABLE:
 		return "T_TABLE"
 	case T_COMMA:
@@ -97,6 +134,8 @@ func (t TokenType) String() string {
 		return "T_DOT"
 	case T_COLON:
 		return "T_COLON"
+	case T_ELLIPSIS:
+		return "T_ELLIPSIS"
 	case T_ASSIGN:
 		return "T_ASSIGN"
 	case T_PLUS:
@@ -109,6 +148,24 @@ func (t TokenType) String() string {
 		return "T_SLASH"
 	case T_BANG:
 		return "T_BANG"
+	case T_PERCENT:
+		return "T_PERCENT"
+	case T_POWER:
+		return "T_POWER"
+	case T_DOUBLE_SLASH:
+		return "T_DOUBLE_SLASH"
+	case T_AMPERSAND:
+		return "T_AMPERSAND"
+	case T_PIPE:
+		return "T_PIPE"
+	case T_CARET:
+		return "T_CARET"
+	case T_TILDE:
+		return "T_TILDE"
+	case T_SHL:
+		return "T_SHL"
+	case T_SHR:
+		return "T_SHR"
 	case T_LT:
 		return "T_LT"
 	case T_LE:
@@ -135,6 +192,20 @@ func (t TokenType) String() string {
 		return "T_RBRACE"
 	case T_DECLARATION:
 		return "T_DECLARATION"
+	case T_PLUS_ASSIGN:
+		return "T_PLUS_ASSIGN"
+	case T_MINUS_ASSIGN:
+		return "T_MINUS_ASSIGN"
+	case T_ASTERISK_ASSIGN:
+		return "T_ASTERISK_ASSIGN"
+	case T_SLASH_ASSIGN:
+		return "T_SLASH_ASSIGN"
+	case T_PERCENT_ASSIGN:
+		return "T_PERCENT_ASSIGN"
+	case T_INC:
+		return "T_INC"
+	case T_DEC:
+		return "T_DEC"
 	case T_FUNCTION:
 		return "T_FUNCTION"
 	case T_TRUE:
@@ -159,6 +230,20 @@ func (t TokenType) String() string {
 		return "T_AND"
 	case T_OR:
 		return "T_OR"
+	case T_IMPORT:
+		return "T_IMPORT"
+	case T_THROW:
+		return "T_THROW"
+	case T_TRY:
+		return "T_TRY"
+	case T_CATCH:
+		return "T_CATCH"
+	case T_DEFER:
+		return "T_DEFER"
+	case T_YIELD:
+		return "T_YIELD"
+	case T_IN:
+		return "T_IN"
 	default:
 		panic("unknown token type to string")
 	}
@@ -192,6 +277,20 @@ func keywordOrIdent(word string) TokenType {
 		return T_OR
 	case "table":
 		return T_TABLE
+	case "import":
+		return T_IMPORT
+	case "throw":
+		return T_THROW
+	case "try":
+		return T_TRY
+	case "catch":
+		return T_CATCH
+	case "defer":
+		return T_DEFER
+	case "yield":
+		return T_YIELD
+	case "in":
+		return T_IN
 	default:
 		return T_IDENT
 	}
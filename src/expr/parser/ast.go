@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"expr/lexer"
 	"fmt"
+	"math/big"
+	"strings"
 )
 
 const indentationBlank = 4
@@ -44,6 +46,17 @@ func (e *IntegerExpr) String(deep int) string {
 	return fmt.Sprintf("%s%d", printIndentation(deep), e.Value)
 }
 
+// 超出 int64 范围的整数字面量
+type BigIntegerExpr struct {
+	Token *lexer.Token
+	Value *big.Int
+}
+
+func (e *BigIntegerExpr) ValueExpr() { var _ ValueExpr = e }
+func (e *BigIntegerExpr) String(deep int) string {
+	return fmt.Sprintf("%s%s", printIndentation(deep), e.Value.String())
+}
+
 type FloatExpr struct {
 	Token *lexer.Token
 	Value float64
@@ -74,6 +87,26 @@ func (e *StringExpr) String(deep int) string {
 	return fmt.Sprintf("%s\"%s\"", printIndentation(deep), e.Value)
 }
 
+// 字面部分为 *StringExpr，其余为 ${} 中的表达式
+type InterpolatedStringExpr struct {
+	Token *lexer.Token
+	Parts []Expression
+}
+
+func (e *InterpolatedStringExpr) String(deep int) string {
+	buf := bytes.Buffer{}
+	buf.WriteString(fmt.Sprintf("%s\"", printIndentation(deep)))
+	for _, part := range e.Parts {
+		if str, ok := part.(*StringExpr); ok {
+			buf.WriteString(strings.ReplaceAll(str.Value, "${", "\\${"))
+		} else {
+			buf.WriteString(fmt.Sprintf("${%s}", part.String(0)))
+		}
+	}
+	buf.WriteString("\"")
+	return buf.String()
+}
+
 type TableExpr struct {
 	Token     *lexer.Token
 	InitValue []KeyValuePair
@@ -163,6 +196,8 @@ func (e *ArithPrefixExpr) String(deep int) string {
 		op = "-"
 	case lexer.T_BANG:
 		op = "!"
+	case lexer.T_TILDE:
+		op = "~"
 	default:
 		panic("unknown ArithPrefixExpr operator")
 	}
@@ -203,6 +238,22 @@ func (e *ArithInfixExpr) String(deep int) string {
 		op = "and"
 	case lexer.T_OR:
 		op = "or"
+	case lexer.T_PERCENT:
+		op = "%"
+	case lexer.T_POWER:
+		op = "**"
+	case lexer.T_DOUBLE_SLASH:
+		op = "//"
+	case lexer.T_AMPERSAND:
+		op = "&"
+	case lexer.T_PIPE:
+		op = "|"
+	case lexer.T_CARET:
+		op = "^"
+	case lexer.T_SHL:
+		op = "<<"
+	case lexer.T_SHR:
+		op = ">>"
 	default:
 		panic("unknown ArithInfixExpr operator")
 	}
@@ -230,6 +281,52 @@ func (e *AssignExpr) String(deep int) string {
 	return fmt.Sprintf("(%s%s = %s)", printIndentation(deep), e.Left.String(0), e.Value.String(0))
 }
 
+type CompoundAssignExpr struct {
+	Token *lexer.Token
+	Op    lexer.TokenType // 对应的二元运算符，如 x += 1 为 T_PLUS
+	Left  AssignableExpr
+	Value Expression
+}
+
+func (e *CompoundAssignExpr) String(deep int) string {
+	var op string
+	switch e.Op {
+	case lexer.T_PLUS:
+		op = "+="
+	case lexer.T_MINUS:
+		op = "-="
+	case lexer.T_ASTERISK:
+		op = "*="
+	case lexer.T_SLASH:
+		op = "/="
+	case lexer.T_PERCENT:
+		op = "%="
+	default:
+		panic("unknown CompoundAssignExpr operator")
+	}
+	return fmt.Sprintf("(%s%s %s %s)", printIndentation(deep), e.Left.String(0), op, e.Value.String(0))
+}
+
+// 后缀 x++ x--，值为自增前的旧值
+type IncDecExpr struct {
+	Token *lexer.Token
+	Op    lexer.TokenType // T_INC or T_DEC
+	Left  AssignableExpr
+}
+
+func (e *IncDecExpr) String(deep int) string {
+	var op string
+	switch e.Op {
+	case lexer.T_INC:
+		op = "++"
+	case lexer.T_DEC:
+		op = "--"
+	default:
+		panic("unknown IncDecExpr operator")
+	}
+	return fmt.Sprintf("%s%s%s", printIndentation(deep), e.Left.String(0), op)
+}
+
 type IfExpr struct {
 	Token       *lexer.Token
 	Condition   Expression
@@ -248,21 +345,74 @@ func (e *IfExpr) String(deep int) string {
 	return buf.String()
 }
 
+type ThrowExpr struct {
+	Token *lexer.Token
+	Value Expression
+}
+
+func (e *ThrowExpr) String(deep int) string {
+	return fmt.Sprintf("%sthrow %s", printIndentation(deep), e.Value.String(0))
+}
+
+type DeferExpr struct {
+	Token *lexer.Token
+	Value Expression
+}
+
+func (e *DeferExpr) String(deep int) string {
+	return fmt.Sprintf("%sdefer %s", printIndentation(deep), e.Value.String(0))
+}
+
+// try Body catch CatchVar Catch
+type TryExpr struct {
+	Token    *lexer.Token
+	Body     *BlockExpr
+	CatchVar *Identifier
+	Catch    *BlockExpr
+}
+
+func (e *TryExpr) String(deep int) string {
+	buf := bytes.Buffer{}
+	buf.WriteString(fmt.Sprintf("%stry", printIndentation(deep)))
+	buf.WriteString(fmt.Sprintf("\n%s", e.Body.String(deep)))
+	buf.WriteString(fmt.Sprintf("\n%scatch %s", printIndentation(deep), e.CatchVar.Ident))
+	buf.WriteString(fmt.Sprintf("\n%s", e.Catch.String(deep)))
+	return buf.String()
+}
+
+// 函数参数：x、带默认值的 x = expr，或收集剩余参数的 ...rest（只能是最后一个）
+type Parameter struct {
+	Name    *Identifier
+	Default Expression
+	IsRest  bool
+}
+
+func (e *Parameter) String(deep int) string {
+	if e.IsRest {
+		return fmt.Sprintf("%s...%s", printIndentation(deep), e.Name.Ident)
+	}
+	if e.Default != nil {
+		return fmt.Sprintf("%s%s = %s", printIndentation(deep), e.Name.Ident, e.Default.String(0))
+	}
+	return fmt.Sprintf("%s%s", printIndentation(deep), e.Name.Ident)
+}
+
 type FuncExpr struct {
-	Token      *lexer.Token
-	Parameters []*Identifier
-	Capture    []FuncCaptureExpr
-	Body       *BlockExpr
+	Token       *lexer.Token
+	Parameters  []*Parameter
+	Capture     []FuncCaptureExpr
+	Body        *BlockExpr
+	IsGenerator bool // 函数体中直接含有 yield
 }
 
 func (f *FuncExpr) String(deep int) string {
 	buf := bytes.Buffer{}
 	buf.WriteString(fmt.Sprintf("%sfunc(", printIndentation(deep)))
-	for i, ident := range f.Parameters {
+	for i, param := range f.Parameters {
 		if i != 0 {
 			buf.WriteString(", ")
 		}
-		buf.WriteString(ident.Ident)
+		buf.WriteString(param.String(0))
 	}
 	buf.WriteString(")[")
 	for i, capture := range f.Capture {
@@ -276,23 +426,59 @@ func (f *FuncExpr) String(deep int) string {
 	return buf.String()
 }
 
-type CallExpr struct {
-	Token      *lexer.Token
-	Function   Expression
-	Parameters []Expression
+// 按名字传递的参数 name = value，位于所有按位置传递的参数之后
+type NamedArg struct {
+	Name  *Identifier
+	Value Expression
 }
 
-func (f *CallExpr) String(deep int) string {
-	buf := bytes.Buffer{}
-	buf.WriteString(fmt.Sprintf("%s%s", printIndentation(deep), f.Function.String(0)))
+func (e *NamedArg) String(deep int) string {
+	return fmt.Sprintf("%s%s = %s", printIndentation(deep), e.Name.Ident, e.Value.String(0))
+}
+
+func writeCallArgs(buf *bytes.Buffer, params []Expression, namedArgs []*NamedArg) {
 	buf.WriteString("(")
-	for i, param := range f.Parameters {
+	for i, param := range params {
 		if i != 0 {
 			buf.WriteString(", ")
 		}
 		buf.WriteString(param.String(0))
 	}
+	for i, arg := range namedArgs {
+		if i != 0 || len(params) != 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString(arg.String(0))
+	}
 	buf.WriteString(")")
+}
+
+type CallExpr struct {
+	Token      *lexer.Token
+	Function   Expression
+	Parameters []Expression
+	NamedArgs  []*NamedArg
+}
+
+func (f *CallExpr) String(deep int) string {
+	buf := bytes.Buffer{}
+	buf.WriteString(fmt.Sprintf("%s%s", printIndentation(deep), f.Function.String(0)))
+	writeCallArgs(&buf, f.Parameters, f.NamedArgs)
+	return buf.String()
+}
+
+type MethodCallExpr struct {
+	Token      *lexer.Token
+	Receiver   Expression
+	Method     *Identifier
+	Parameters []Expression
+	NamedArgs  []*NamedArg
+}
+
+func (f *MethodCallExpr) String(deep int) string {
+	buf := bytes.Buffer{}
+	buf.WriteString(fmt.Sprintf("%s%s:%s", printIndentation(deep), f.Receiver.String(0), f.Method.Ident))
+	writeCallArgs(&buf, f.Parameters, f.NamedArgs)
 	return buf.String()
 }
 
@@ -321,6 +507,26 @@ func (e *ReturnExpr) String(deep int) string {
 	return fmt.Sprintf("%sreturn %s", printIndentation(deep), e.ReturnValue.String(0))
 }
 
+// 调用参数中的 ...pack，把 pack 展开为多个参数
+type SpreadExpr struct {
+	Token *lexer.Token
+	Value Expression
+}
+
+func (e *SpreadExpr) String(deep int) string {
+	return fmt.Sprintf("%s...%s", printIndentation(deep), e.Value.String(0))
+}
+
+// import "path"，Path 为去掉引号的字符串
+type ImportExpr struct {
+	Token *lexer.Token
+	Path  string
+}
+
+func (e *ImportExpr) String(deep int) string {
+	return fmt.Sprintf("%simport %q", printIndentation(deep), e.Path)
+}
+
 type BlockExpr struct {
 	Token *lexer.Token
 	Exprs []Expression
@@ -351,6 +557,36 @@ func (f *ForExpr) String(deep int) string {
 	return forHead + f.Body.String(deep)
 }
 
+// for a, b in Iterable Body
+type ForInExpr struct {
+	Token    *lexer.Token
+	Vars     []*Identifier
+	Iterable Expression
+	Body     *BlockExpr
+}
+
+func (f *ForInExpr) String(deep int) string {
+	vars := make([]string, 0, len(f.Vars))
+	for _, v := range f.Vars {
+		vars = append(vars, v.Ident)
+	}
+	forHead := fmt.Sprintf("%sfor %s in %s\n", printIndentation(deep), strings.Join(vars, ", "), f.Iterable.String(0))
+	return forHead + f.Body.String(deep)
+}
+
+// Value 为 nil 时产生 nil
+type YieldExpr struct {
+	Token *lexer.Token
+	Value Expression
+}
+
+func (e *YieldExpr) String(deep int) string {
+	if e.Value == nil {
+		return fmt.Sprintf("%syield", printIndentation(deep))
+	}
+	return fmt.Sprintf("%syield %s", printIndentation(deep), e.Value.String(0))
+}
+
 type BreakExpr struct {
 	Token      *lexer.Token
 	BreakValue Expression
@@ -10,7 +10,7 @@ type TokenError struct {
 }
 
 func (t TokenError) Error() string {
-	return "TokenError: " + t.Token.String()
+	return fmt.Sprintf("TokenError: %s column: %d", t.Token.String(), t.Token.Column)
 }
 
 type ParseError struct {
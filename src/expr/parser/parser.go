@@ -1,8 +1,11 @@
 package parser
 
 import (
+	"errors"
 	"expr/lexer"
+	"math/big"
 	"strconv"
+	"strings"
 )
 
 type prefixParseFn func() (Expression, *ParseError)
@@ -16,6 +19,9 @@ type Parser struct {
 
 	prefixParseFns map[lexer.TokenType]prefixParseFn
 	infixParseFns  map[lexer.TokenType]infixParseFn
+
+	funcYields []bool // 正在解析的各层函数体中是否出现了 yield
+	illegal    bool   // 已经报告了非法 token
 }
 
 func New(l *lexer.Lexer) *Parser {
@@ -34,11 +40,19 @@ func (p *Parser) nextToken() *lexer.Token {
 	token := p.peekToken
 	p.peekToken = p.lexer.NextToken()
 	if p.peekToken.Type == lexer.T_ILLEGAL {
+		p.illegal = true
 		p.Errors = append(p.Errors, &TokenError{Token: p.nextToken()})
 	}
 	return token
 }
 
+// 非法 token 之后的语法错误通常是跳过它引起的连带错误，不再报告
+func (p *Parser) reportError(err error) {
+	if !p.illegal {
+		p.Errors = append(p.Errors, err)
+	}
+}
+
 func (p *Parser) checkPeekToken(tt lexer.TokenType) *ParseError {
 	if p.peekToken.Type != tt {
 		return &ParseError{
@@ -59,7 +73,7 @@ func (p *Parser) ParseProgram() *BlockExpr {
 	for p.peekToken.Type != lexer.T_EOF {
 		expr, err := p.parseEntireExpr()
 		if err != nil {
-			p.Errors = append(p.Errors, err)
+			p.reportError(err)
 		} else {
 			block.Exprs = append(block.Exprs, expr)
 		}
@@ -77,10 +91,10 @@ func (p *Parser) parseBlockExpr() (Expression, *ParseError) {
 		Token: token,
 		Exprs: nil,
 	}
-	for p.peekToken.Type != lexer.T_RBRACE {
+	for p.peekToken.Type != lexer.T_RBRACE && p.peekToken.Type != lexer.T_EOF {
 		expr, err := p.parseEntireExpr()
 		if err != nil {
-			p.Errors = append(p.Errors, err)
+			p.reportError(err)
 		} else {
 			block.Exprs = append(block.Exprs, expr)
 		}
@@ -107,33 +121,53 @@ const (
 	AND                // and
 	EQUALS             // == >= <=
 	COMPARE            // > <
+	BIT_OR             // |
+	BIT_XOR            // ^
+	BIT_AND            // &
+	SHIFT              // << >>
 	SUM                // +
-	PRODUCT            // *
-	PREFIX             // -X or !X
+	PRODUCT            // * / // %
+	PREFIX             // -X or !X or ~X
+	POWER              // **
 	CALL               // myFunction(X)
 )
 
 var tokenPrecedences = map[lexer.TokenType]Precedence{
-	lexer.T_SEMICOLON:   LOWEST,
-	lexer.T_RPAREN:      LOWEST,
-	lexer.T_DECLARATION: ASSIGN,
-	lexer.T_ASSIGN:      ASSIGN,
-	lexer.T_OR:          OR,
-	lexer.T_AND:         AND,
-	lexer.T_EQ:          EQUALS,
-	lexer.T_NEQ:         EQUALS,
-	lexer.T_GE:          EQUALS,
-	lexer.T_LE:          EQUALS,
-	lexer.T_GT:          COMPARE,
-	lexer.T_LT:          COMPARE,
-	lexer.T_PLUS:        SUM,
-	lexer.T_MINUS:       SUM,
-	lexer.T_ASTERISK:    PRODUCT,
-	lexer.T_SLASH:       PRODUCT,
-	lexer.T_LPAREN:      CALL,
-	lexer.T_DOT:         CALL,
-	lexer.T_LBRACKET:    CALL,
-	lexer.T_COLON:       CALL,
+	lexer.T_SEMICOLON:       LOWEST,
+	lexer.T_RPAREN:          LOWEST,
+	lexer.T_DECLARATION:     ASSIGN,
+	lexer.T_ASSIGN:          ASSIGN,
+	lexer.T_PLUS_ASSIGN:     ASSIGN,
+	lexer.T_MINUS_ASSIGN:    ASSIGN,
+	lexer.T_ASTERISK_ASSIGN: ASSIGN,
+	lexer.T_SLASH_ASSIGN:    ASSIGN,
+	lexer.T_PERCENT_ASSIGN:  ASSIGN,
+	lexer.T_OR:              OR,
+	lexer.T_AND:             AND,
+	lexer.T_EQ:              EQUALS,
+	lexer.T_NEQ:             EQUALS,
+	lexer.T_GE:              EQUALS,
+	lexer.T_LE:              EQUALS,
+	lexer.T_GT:              COMPARE,
+	lexer.T_LT:              COMPARE,
+	lexer.T_PLUS:            SUM,
+	lexer.T_MINUS:           SUM,
+	lexer.T_ASTERISK:        PRODUCT,
+	lexer.T_SLASH:           PRODUCT,
+	lexer.T_DOUBLE_SLASH:    PRODUCT,
+	lexer.T_PERCENT:         PRODUCT,
+	lexer.T_POWER:           POWER,
+	lexer.T_PIPE:            BIT_OR,
+	lexer.T_CARET:           BIT_XOR,
+	lexer.T_AMPERSAND:       BIT_AND,
+	lexer.T_SHL:             SHIFT,
+	lexer.T_SHR:             SHIFT,
+	lexer.T_LPAREN:          CALL,
+	lexer.T_DOT:             CALL,
+	lexer.T_LBRACKET:        CALL,
+	lexer.T_COLON:           CALL,
+	lexer.T_INC:             CALL,
+	lexer.T_DEC:             CALL,
 }
 
 func (p *Parser) parseEntireExpr() (Expression, *ParseError) {
@@ -176,11 +210,17 @@ func (p *Parser) registerParseFn() {
 	p.prefixParseFns[lexer.T_TRUE] = p.parseBoolean
 	p.prefixParseFns[lexer.T_FALSE] = p.parseBoolean
 	p.prefixParseFns[lexer.T_STRING] = p.parseString
+	p.prefixParseFns[lexer.T_INTERP_STRING] = p.parseInterpolatedString
 	p.prefixParseFns[lexer.T_TABLE] = p.parseTableExpr
 	p.prefixParseFns[lexer.T_LBRACKET] = p.parsePackExpr
 	p.prefixParseFns[lexer.T_NIL] = p.parseNil
 	p.prefixParseFns[lexer.T_IDENT] = p.parserIdentifier
 	p.prefixParseFns[lexer.T_RETURN] = p.parserReturnExpr
+	p.prefixParseFns[lexer.T_IMPORT] = p.parseImportExpr
+	p.prefixParseFns[lexer.T_THROW] = p.parseThrowExpr
+	p.prefixParseFns[lexer.T_TRY] = p.parseTryExpr
+	p.prefixParseFns[lexer.T_DEFER] = p.parseDeferExpr
+	p.prefixParseFns[lexer.T_YIELD] = p.parseYieldExpr
 	p.prefixParseFns[lexer.T_BREAK] = p.parserBreakExpr
 	p.prefixParseFns[lexer.T_LPAREN] = p.parseGroupedExpr
 	p.prefixParseFns[lexer.T_LBRACE] = p.parseBlockExpr
@@ -189,11 +229,22 @@ func (p *Parser) registerParseFn() {
 	p.prefixParseFns[lexer.T_FOR] = p.parseForExpr
 	p.prefixParseFns[lexer.T_MINUS] = p.parseArithPrefixExpr
 	p.prefixParseFns[lexer.T_BANG] = p.parseArithPrefixExpr
+	p.prefixParseFns[lexer.T_TILDE] = p.parseArithPrefixExpr
+	p.prefixParseFns[lexer.T_DEC] = p.parseDoubleMinusExpr
+	p.prefixParseFns[lexer.T_ELLIPSIS] = p.parseSpreadExpr
 
 	p.infixParseFns[lexer.T_DECLARATION] = p.parserDeclarationExpr
 	p.infixParseFns[lexer.T_ASSIGN] = p.parserAssignExpr
+	p.infixParseFns[lexer.T_PLUS_ASSIGN] = p.parserCompoundAssignExpr
+	p.infixParseFns[lexer.T_MINUS_ASSIGN] = p.parserCompoundAssignExpr
+	p.infixParseFns[lexer.T_ASTERISK_ASSIGN] = p.parserCompoundAssignExpr
+	p.infixParseFns[lexer.T_SLASH_ASSIGN] = p.parserCompoundAssignExpr
+	p.infixParseFns[lexer.T_PERCENT_ASSIGN] = p.parserCompoundAssignExpr
+	p.infixParseFns[lexer.T_INC] = p.parserIncDecExpr
+	p.infixParseFns[lexer.T_DEC] = p.parserIncDecExpr
 	p.infixParseFns[lexer.T_LPAREN] = p.parseCallExpr
 	p.infixParseFns[lexer.T_DOT] = p.parseDotExpr
+	p.infixParseFns[lexer.T_COLON] = p.parseMethodCallExpr
 	p.infixParseFns[lexer.T_PLUS] = p.parseArithInfixExpr
 	p.infixParseFns[lexer.T_MINUS] = p.parseArithInfixExpr
 	p.infixParseFns[lexer.T_ASTERISK] = p.parseArithInfixExpr
@@ -206,11 +257,27 @@ func (p *Parser) registerParseFn() {
 	p.infixParseFns[lexer.T_GT] = p.parseArithInfixExpr
 	p.infixParseFns[lexer.T_AND] = p.parseArithInfixExpr
 	p.infixParseFns[lexer.T_OR] = p.parseArithInfixExpr
+	p.infixParseFns[lexer.T_PERCENT] = p.parseArithInfixExpr
+	p.infixParseFns[lexer.T_POWER] = p.parseArithInfixExpr
+	p.infixParseFns[lexer.T_DOUBLE_SLASH] = p.parseArithInfixExpr
+	p.infixParseFns[lexer.T_AMPERSAND] = p.parseArithInfixExpr
+	p.infixParseFns[lexer.T_PIPE] = p.parseArithInfixExpr
+	p.infixParseFns[lexer.T_CARET] = p.parseArithInfixExpr
+	p.infixParseFns[lexer.T_SHL] = p.parseArithInfixExpr
+	p.infixParseFns[lexer.T_SHR] = p.parseArithInfixExpr
 }
 
 func (p *Parser) parseInteger() (Expression, *ParseError) {
 	token := p.nextToken()
 	val, err := strconv.ParseInt(token.Message, 0, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		if bigVal, ok := new(big.Int).SetString(token.Message, 0); ok {
+			return &BigIntegerExpr{
+				Token: token,
+				Value: bigVal,
+			}, nil
+		}
+	}
 	if err != nil {
 		return nil, &ParseError{
 			GotToken:        token,
@@ -277,6 +344,41 @@ func (p *Parser) parseString() (Expression, *ParseError) {
 	}
 }
 
+// ${} 中的表达式用独立的 lexer 和 parser 解析，错误合并到当前 parser
+func (p *Parser) parseInterpolatedString() (Expression, *ParseError) {
+	token := p.nextToken()
+	expr := &InterpolatedStringExpr{
+		Token: token,
+		Parts: nil,
+	}
+	for _, part := range token.Parts {
+		if !part.IsExpr {
+			if part.Text != "" {
+				expr.Parts = append(expr.Parts, &StringExpr{Token: token, Value: part.Text})
+			}
+			continue
+		}
+		sub := New(lexer.NewAt(strings.NewReader(part.Text), part.Line, part.Column))
+		// ${} 中的 yield 属于外层函数，使其成为生成器
+		sub.funcYields = append([]bool(nil), p.funcYields...)
+		sub.nextToken()
+		partExpr, err := sub.parseEntireExpr()
+		if err != nil {
+			return nil, err
+		}
+		copy(p.funcYields, sub.funcYields)
+		if err := sub.checkPeekToken(lexer.T_EOF); err != nil {
+			err.Message = "string interpolation expect a single expression"
+			return nil, err
+		}
+		if len(sub.Errors) != 0 {
+			p.Errors = append(p.Errors, sub.Errors...)
+		}
+		expr.Parts = append(expr.Parts, partExpr)
+	}
+	return expr, nil
+}
+
 func (p *Parser) parseNil() (Expression, *ParseError) {
 	token := p.nextToken()
 	if token.Type == lexer.T_NIL {
@@ -312,6 +414,18 @@ func (p *Parser) parserReturnExpr() (Expression, *ParseError) {
 	}, nil
 }
 
+func (p *Parser) parseImportExpr() (Expression, *ParseError) {
+	token := p.nextToken()
+	if err := p.checkPeekToken(lexer.T_STRING); err != nil {
+		return nil, err
+	}
+	path := p.nextToken()
+	return &ImportExpr{
+		Token: token,
+		Path:  path.Message,
+	}, nil
+}
+
 func (p *Parser) parserBreakExpr() (Expression, *ParseError) {
 	token := p.nextToken()
 	val, err := p.parseEntireExpr()
@@ -367,12 +481,90 @@ func (p *Parser) parserAssignExpr(leftExpr Expression) (Expression, *ParseError)
 	}, nil
 }
 
+var compoundAssignOps = map[lexer.TokenType]lexer.TokenType{
+	lexer.T_PLUS_ASSIGN:     lexer.T_PLUS,
+	lexer.T_MINUS_ASSIGN:    lexer.T_MINUS,
+	lexer.T_ASTERISK_ASSIGN: lexer.T_ASTERISK,
+	lexer.T_SLASH_ASSIGN:    lexer.T_SLASH,
+	lexer.T_PERCENT_ASSIGN:  lexer.T_PERCENT,
+}
+
+// 复合赋值只能作用于单个变量或表索引，不能是 pack
+func compoundAssignable(expr Expression) (AssignableExpr, bool) {
+	switch expr := expr.(type) {
+	case *Identifier:
+		return expr, true
+	case *IndexExpr:
+		return expr, true
+	default:
+		return nil, false
+	}
+}
+
+func (p *Parser) parserCompoundAssignExpr(leftExpr Expression) (Expression, *ParseError) {
+	token := p.nextToken()
+	left, ok := compoundAssignable(leftExpr)
+	if !ok || !left.IsAssignable() {
+		return nil, &ParseError{
+			GotToken:        token,
+			ExpectTokenType: 0,
+			Message:         "compound assign's left expression must be identifier or index",
+		}
+	}
+	right, err := p.parseExpr(ASSIGN - 1)
+	if err != nil {
+		return nil, err
+	}
+	return &CompoundAssignExpr{
+		Token: token,
+		Op:    compoundAssignOps[token.Type],
+		Left:  left,
+		Value: right,
+	}, nil
+}
+
+func (p *Parser) parserIncDecExpr(leftExpr Expression) (Expression, *ParseError) {
+	token := p.nextToken()
+	left, ok := compoundAssignable(leftExpr)
+	if !ok || !left.IsAssignable() {
+		return nil, &ParseError{
+			GotToken:        token,
+			ExpectTokenType: 0,
+			Message:         "increment/decrement operand must be identifier or index",
+		}
+	}
+	return &IncDecExpr{
+		Token: token,
+		Op:    token.Type,
+		Left:  left,
+	}, nil
+}
+
+// 前缀位置的 -- 仍然是两次取负
+func (p *Parser) parseDoubleMinusExpr() (Expression, *ParseError) {
+	token := p.nextToken()
+	right, err := p.parseExpr(PREFIX)
+	if err != nil {
+		return nil, err
+	}
+	return &ArithPrefixExpr{
+		Token: token,
+		Op:    lexer.T_MINUS,
+		Right: &ArithPrefixExpr{
+			Token: token,
+			Op:    lexer.T_MINUS,
+			Right: right,
+		},
+	}, nil
+}
+
 func (p *Parser) parseArithInfixExpr(leftExpr Expression) (Expression, *ParseError) {
 	token := p.nextToken()
 	switch token.Type {
 	case lexer.T_PLUS, lexer.T_MINUS, lexer.T_ASTERISK, lexer.T_SLASH,
 		lexer.T_EQ, lexer.T_NEQ, lexer.T_LE, lexer.T_GE, lexer.T_LT, lexer.T_GT,
-		lexer.T_AND, lexer.T_OR:
+		lexer.T_AND, lexer.T_OR, lexer.T_PERCENT, lexer.T_POWER, lexer.T_DOUBLE_SLASH,
+		lexer.T_AMPERSAND, lexer.T_PIPE, lexer.T_CARET, lexer.T_SHL, lexer.T_SHR:
 		break
 	default:
 		return nil, &ParseError{
@@ -383,6 +575,9 @@ func (p *Parser) parseArithInfixExpr(leftExpr Expression) (Expression, *ParseErr
 	}
 
 	prePrecedence := tokenPrecedences[token.Type]
+	if token.Type == lexer.T_POWER {
+		prePrecedence-- // 幂运算右结合
+	}
 	right, err := p.parseExpr(prePrecedence)
 	if err != nil {
 		return nil, err
@@ -398,7 +593,7 @@ func (p *Parser) parseArithInfixExpr(leftExpr Expression) (Expression, *ParseErr
 func (p *Parser) parseArithPrefixExpr() (Expression, *ParseError) {
 	token := p.nextToken()
 	switch token.Type {
-	case lexer.T_MINUS, lexer.T_BANG:
+	case lexer.T_MINUS, lexer.T_BANG, lexer.T_TILDE:
 		break
 	default:
 		return nil, &ParseError{
@@ -517,6 +712,81 @@ func (p *Parser) parseIfExpr() (Expression, *ParseError) {
 	}
 }
 
+func (p *Parser) parseThrowExpr() (Expression, *ParseError) {
+	token := p.nextToken()
+	val, err := p.parseEntireExpr()
+	if err != nil {
+		return nil, err
+	}
+	return &ThrowExpr{
+		Token: token,
+		Value: val,
+	}, nil
+}
+
+func (p *Parser) parseDeferExpr() (Expression, *ParseError) {
+	token := p.nextToken()
+	val, err := p.parseEntireExpr()
+	if err != nil {
+		return nil, err
+	}
+	return &DeferExpr{
+		Token: token,
+		Value: val,
+	}, nil
+}
+
+func (p *Parser) parseYieldExpr() (Expression, *ParseError) {
+	token := p.nextToken()
+	if len(p.funcYields) == 0 {
+		return nil, &ParseError{
+			GotToken:        token,
+			ExpectTokenType: 0,
+			Message:         "yield outside function",
+		}
+	}
+	p.funcYields[len(p.funcYields)-1] = true
+	yieldExpr := &YieldExpr{
+		Token: token,
+		Value: nil,
+	}
+	switch p.peekToken.Type {
+	case lexer.T_SEMICOLON, lexer.T_RBRACE, lexer.T_RPAREN, lexer.T_EOF:
+		return yieldExpr, nil
+	}
+	val, err := p.parseEntireExpr()
+	if err != nil {
+		return nil, err
+	}
+	yieldExpr.Value = val
+	return yieldExpr, nil
+}
+
+func (p *Parser) parseTryExpr() (Expression, *ParseError) {
+	token := p.nextToken()
+	body, err := p.parseImplicitBlockExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.checkPeekToken(lexer.T_CATCH); err != nil {
+		return nil, err
+	}
+	p.nextToken()
+	tryExpr := &TryExpr{
+		Token: token,
+		Body:  body,
+	}
+	if err := p.checkPeekToken(lexer.T_IDENT); err != nil {
+		return nil, err
+	}
+	ident := p.nextToken()
+	tryExpr.CatchVar = &Identifier{Token: ident, Ident: ident.Message}
+	if tryExpr.Catch, err = p.parseImplicitBlockExpr(); err != nil {
+		return nil, err
+	}
+	return tryExpr, nil
+}
+
 func (p *Parser) parseFuncExpr() (Expression, *ParseError) {
 	token := p.nextToken()
 	funcExpr := &FuncExpr{
@@ -532,16 +802,19 @@ func (p *Parser) parseFuncExpr() (Expression, *ParseError) {
 		if err != nil {
 			return nil, err
 		}
-		for _, param := range parameters {
-			if Ident, ok := param.(*Identifier); ok {
-				funcExpr.Parameters = append(funcExpr.Parameters, Ident)
-			} else {
+		for i, param := range parameters {
+			parameter, err := toParameter(param)
+			if err != nil {
+				return nil, err
+			}
+			if parameter.IsRest && i != len(parameters)-1 {
 				return nil, &ParseError{
 					GotToken:        nil,
 					ExpectTokenType: 0,
-					Message:         "function parameter type error, could only be identifier",
+					Message:         "rest parameter must be the last parameter",
 				}
 			}
+			funcExpr.Parameters = append(funcExpr.Parameters, parameter)
 		}
 	}
 
@@ -565,7 +838,10 @@ func (p *Parser) parseFuncExpr() (Expression, *ParseError) {
 	}
 
 	//read body
+	p.funcYields = append(p.funcYields, false)
 	body, err := p.parseImplicitBlockExpr()
+	funcExpr.IsGenerator = p.funcYields[len(p.funcYields)-1]
+	p.funcYields = p.funcYields[:len(p.funcYields)-1]
 	if err != nil {
 		return nil, err
 	}
@@ -574,6 +850,36 @@ func (p *Parser) parseFuncExpr() (Expression, *ParseError) {
 	return funcExpr, nil
 }
 
+// 参数列表按普通表达式解析，x = expr 解析为 AssignExpr，...x 解析为 SpreadExpr
+func toParameter(param Expression) (*Parameter, *ParseError) {
+	switch param := param.(type) {
+	case *Identifier:
+		return &Parameter{Name: param}, nil
+	case *AssignExpr:
+		if ident, ok := param.Left.(*Identifier); ok {
+			return &Parameter{Name: ident, Default: param.Value}, nil
+		}
+	case *SpreadExpr:
+		if ident, ok := param.Value.(*Identifier); ok {
+			return &Parameter{Name: ident, IsRest: true}, nil
+		}
+	}
+	return nil, &ParseError{
+		GotToken:        nil,
+		ExpectTokenType: 0,
+		Message:         "function parameter type error, could only be identifier, identifier = default or ...identifier",
+	}
+}
+
+func (p *Parser) parseSpreadExpr() (Expression, *ParseError) {
+	token := p.nextToken()
+	value, err := p.parseExpr(PREFIX)
+	if err != nil {
+		return nil, err
+	}
+	return &SpreadExpr{Token: token, Value: value}, nil
+}
+
 func (p *Parser) parseIndexExpr() (Expression, *ParseError) {
 	if p.peekToken.Type == lexer.T_IDENT {
 		stringIndexToken := p.nextToken()
@@ -602,6 +908,10 @@ func (p *Parser) parseIndexExpr() (Expression, *ParseError) {
 
 func (p *Parser) parseTableExpr() (Expression, *ParseError) {
 	token := p.nextToken()
+	// 后面不是 { 时 table 作为普通标识符，用于访问 table 库
+	if p.peekToken.Type != lexer.T_LBRACE {
+		return &Identifier{Token: token, Ident: "table"}, nil
+	}
 	table := &TableExpr{
 		Token:     token,
 		InitValue: nil,
@@ -652,7 +962,7 @@ func (p *Parser) parseDotExpr(leftExpr Expression) (Expression, *ParseError) {
 }
 func (p *Parser) parseCallExpr(leftExpr Expression) (Expression, *ParseError) {
 	token := p.peekToken
-	parameters, err := p.parseCommaExprs(lexer.T_LPAREN, lexer.T_RPAREN)
+	parameters, namedArgs, err := p.parseCallArgs()
 	if err != nil {
 		return nil, err
 	}
@@ -660,6 +970,58 @@ func (p *Parser) parseCallExpr(leftExpr Expression) (Expression, *ParseError) {
 		Token:      token,
 		Function:   leftExpr,
 		Parameters: parameters,
+		NamedArgs:  namedArgs,
+	}, nil
+}
+
+// 参数中的 name = value 是按名字传递的参数，必须位于按位置传递的参数之后
+func (p *Parser) parseCallArgs() ([]Expression, []*NamedArg, *ParseError) {
+	args, err := p.parseCommaExprs(lexer.T_LPAREN, lexer.T_RPAREN)
+	if err != nil {
+		return nil, nil, err
+	}
+	var parameters []Expression
+	var namedArgs []*NamedArg
+	for _, arg := range args {
+		if assign, ok := arg.(*AssignExpr); ok {
+			if ident, ok := assign.Left.(*Identifier); ok {
+				namedArgs = append(namedArgs, &NamedArg{Name: ident, Value: assign.Value})
+				continue
+			}
+		}
+		if len(namedArgs) != 0 {
+			return nil, nil, &ParseError{
+				GotToken:        nil,
+				ExpectTokenType: 0,
+				Message:         "positional argument after named argument",
+			}
+		}
+		parameters = append(parameters, arg)
+	}
+	return parameters, namedArgs, nil
+}
+
+func (p *Parser) parseMethodCallExpr(leftExpr Expression) (Expression, *ParseError) {
+	token := p.nextToken()
+	if err := p.checkPeekToken(lexer.T_IDENT); err != nil {
+		err.Message = "method call expect method name after ':'"
+		return nil, err
+	}
+	methodToken := p.nextToken()
+	if err := p.checkPeekToken(lexer.T_LPAREN); err != nil {
+		err.Message = "method call expect parameters after method name"
+		return nil, err
+	}
+	parameters, namedArgs, err := p.parseCallArgs()
+	if err != nil {
+		return nil, err
+	}
+	return &MethodCallExpr{
+		Token:      token,
+		Receiver:   leftExpr,
+		Method:     &Identifier{Token: methodToken, Ident: methodToken.Message},
+		Parameters: parameters,
+		NamedArgs:  namedArgs,
 	}, nil
 }
 
@@ -669,6 +1031,9 @@ func (p *Parser) parseForExpr() (Expression, *ParseError) {
 	if err != nil {
 		return nil, err
 	}
+	if ident, ok := initExpr.(*Identifier); ok && (p.peekToken.Type == lexer.T_IN || p.peekToken.Type == lexer.T_COMMA) {
+		return p.parseForInExpr(token, ident)
+	}
 	if err := p.checkPeekToken(lexer.T_SEMICOLON); err != nil {
 		return nil, err
 	} else {
@@ -706,6 +1071,37 @@ func (p *Parser) parseForExpr() (Expression, *ParseError) {
 	}, nil
 }
 
+func (p *Parser) parseForInExpr(token *lexer.Token, first *Identifier) (Expression, *ParseError) {
+	forIn := &ForInExpr{
+		Token: token,
+		Vars:  []*Identifier{first},
+	}
+	for p.peekToken.Type == lexer.T_COMMA {
+		p.nextToken()
+		if err := p.checkPeekToken(lexer.T_IDENT); err != nil {
+			return nil, err
+		}
+		ident := p.nextToken()
+		forIn.Vars = append(forIn.Vars, &Identifier{Token: ident, Ident: ident.Message})
+	}
+	if err := p.checkPeekToken(lexer.T_IN); err != nil {
+		return nil, err
+	}
+	p.nextToken()
+	iterable, err := p.parseEntireExpr()
+	if err != nil {
+		return nil, err
+	}
+	forIn.Iterable = iterable
+	if p.peekToken.Type == lexer.T_SEMICOLON {
+		p.nextToken()
+	}
+	if forIn.Body, err = p.parseImplicitBlockExpr(); err != nil {
+		return nil, err
+	}
+	return forIn, nil
+}
+
 func (p *Parser) parsePackExpr() (Expression, *ParseError) {
 	pack := &PackExpr{
 		Token: p.peekToken,
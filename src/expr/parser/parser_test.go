@@ -12,6 +12,58 @@ func TestParseValue(t *testing.T) {
 	//fmt.Println(block.String(0))
 }
 
+func TestBigInteger(t *testing.T) {
+	block := simpleTestParse(t, `9223372036854775807 9223372036854775808 123456789012345678901234567890`)
+	if _, ok := block.Exprs[0].(*IntegerExpr); !ok {
+		t.Errorf("expect IntegerExpr for max int64")
+	}
+	for _, expr := range block.Exprs[1:] {
+		if _, ok := expr.(*BigIntegerExpr); !ok {
+			t.Errorf("expect BigIntegerExpr, got %s", expr.String(0))
+		}
+	}
+	if got := block.Exprs[2].String(0); got != "123456789012345678901234567890" {
+		t.Errorf("BigIntegerExpr String error %s", got)
+	}
+}
+
+func TestNumberLiteral(t *testing.T) {
+	block := simpleTestParse(t, `0x1F 0o17 0b101 1_000 1e3 2.5e-1 0xFFFF_FFFF_FFFF_FFFF_FF`)
+	expect := "31\n15\n5\n1000\n1000f\n0.25f\n4722366482869645213695"
+	if got := joinExprs(block); got != expect {
+		t.Errorf("number literal parse error, got:\n%s", got)
+	}
+	// 非法的字面量只报告一个错误
+	for _, input := range []string{`x := 0755`, `f(0xZZ)`, `08`} {
+		p := New(lexer.New(bytes.NewBufferString(input)))
+		p.ParseProgram()
+		if len(p.Errors) != 1 {
+			t.Errorf("input %s: expect 1 error, got %v", input, p.Errors)
+		}
+	}
+}
+
+func TestInterpolatedString(t *testing.T) {
+	block := simpleTestParse(t, `
+"hello ${user.name}, you have ${len(items)} items"
+"${a}${b + 1}"
+"${ f("}") } \${raw} $5"
+`)
+	expect := `"hello ${user.["name"]}, you have ${len(items)} items"
+"${a}${(b + 1)}"
+"${f("}")} \${raw} $5"`
+	if got := joinExprs(block); got != expect {
+		t.Errorf("interpolated string parse error, got:\n%s", got)
+	}
+	for _, input := range []string{`"${}"`, `"${ 1 2 }"`, `"${ a + }"`, `"${a"`} {
+		p := New(lexer.New(bytes.NewBufferString(input)))
+		p.ParseProgram()
+		if len(p.Errors) == 0 {
+			t.Errorf("expect parse error for %s", input)
+		}
+	}
+}
+
 func TestArithExpr(t *testing.T) {
 	//block :=
 	simpleTestParse(t, `
@@ -26,6 +78,30 @@ true and 21 or 12 and -ident or 1 == 2 and 3 < 4
 	//fmt.Println(block.String(0))
 }
 
+func TestExtendArithExpr(t *testing.T) {
+	block := simpleTestParse(t, `
+7 % 3 + 1
+2 ** 3 ** 2;
+-2 ** 2
+7 // 2 * 3
+1 | 2 ^ 3 & 4
+1 << 2 + 3
+~x & 255
+a == b | c
+`)
+	expect := `((7 % 3) + 1)
+(2 ** (3 ** 2))
+-(2 ** 2)
+((7 // 2) * 3)
+(1 | (2 ^ (3 & 4)))
+(1 << (2 + 3))
+(~x & 255)
+(a == (b | c))`
+	if got := joinExprs(block); got != expect {
+		t.Errorf("extend arith parse error, got:\n%s", got)
+	}
+}
+
 func TestBlockExpr(t *testing.T) {
 	//block :=
 	simpleTestParse(t, `
@@ -70,6 +146,37 @@ x = y = z = 1+1+1
 	//fmt.Println(block.String(0))
 }
 
+func TestCompoundAssignExpr(t *testing.T) {
+	block := simpleTestParse(t, `
+x += 1
+t.count -= 2 * 3
+t.[k] *= y /= 2
+x %= 3;
+x++ + 1
+t.a.b--;
+--x;
+a--b
+`)
+	expect := `(x += 1)
+(t.["count"] -= (2 * 3))
+(t.[k] *= (y /= 2))
+(x %= 3)
+(x++ + 1)
+t.["a"].["b"]--
+--x
+(a - -b)`
+	if got := joinExprs(block); got != expect {
+		t.Errorf("compound assign parse error, got:\n%s", got)
+	}
+	for _, input := range []string{"1 += 2", "[x, y] += 1", "f() += 1", "1++", "(x + 1)--"} {
+		p := New(lexer.New(bytes.NewBufferString(input)))
+		p.ParseProgram()
+		if len(p.Errors) == 0 {
+			t.Errorf("expect parse error for %s", input)
+		}
+	}
+}
+
 func TestFuncExpr(t *testing.T) {
 	//block :=
 	simpleTestParse(t, `
@@ -106,6 +213,80 @@ func(x,y)[] return x; (1,2)
 	//fmt.Println(block.String(0))
 }
 
+func TestMethodCallExpr(t *testing.T) {
+	block := simpleTestParse(t, `
+t:method()
+t:method(1, 2):chain(3)
+t.inner:method(x + 1)
+`)
+	expect := "t:method()\nt:method(1, 2):chain(3)\nt.[\"inner\"]:method((x + 1))"
+	if got := joinExprs(block); got != expect {
+		t.Errorf("method call parse error, got:\n%s", got)
+	}
+	for _, input := range []string{"t:1", "t:method", "t:(1)"} {
+		p := New(lexer.New(bytes.NewBufferString(input)))
+		p.ParseProgram()
+		if len(p.Errors) == 0 {
+			t.Errorf("expect parse error for %s", input)
+		}
+	}
+}
+
+func TestTableIdentifier(t *testing.T) {
+	block := simpleTestParse(t, `
+table.keys(t)
+x := table{ a = table.values }
+`)
+	expect := "table.[\"keys\"](t)\nx := table{ key:value\n    \"a\" = table.[\"values\"]\n}"
+	if got := joinExprs(block); got != expect {
+		t.Errorf("table identifier parse error, got:\n%s", got)
+	}
+}
+
+func TestImportExpr(t *testing.T) {
+	block := simpleTestParse(t, `
+m := import "lib/util.expr";
+(import "a").f(1)
+`)
+	expect := "m := import \"lib/util.expr\"\nimport \"a\".[\"f\"](1)"
+	if got := joinExprs(block); got != expect {
+		t.Errorf("import parse error, got:\n%s", got)
+	}
+	for _, input := range []string{"import", "import x", "import \"${x}\""} {
+		p := New(lexer.New(bytes.NewBufferString(input)))
+		p.ParseProgram()
+		if len(p.Errors) == 0 {
+			t.Errorf("expect parse error for %s", input)
+		}
+	}
+}
+
+func TestDeferExpr(t *testing.T) {
+	block := simpleTestParse(t, `defer f(x); defer t.n += 1`)
+	expect := "defer f(x)\ndefer (t.[\"n\"] += 1)"
+	if got := joinExprs(block); got != expect {
+		t.Errorf("defer parse error, got:\n%s", got)
+	}
+}
+
+func TestTryExpr(t *testing.T) {
+	block := simpleTestParse(t, `
+x := try { f() } catch e { throw e };
+try f() catch _ g()
+`)
+	expect := "x := try\n{\n    f()\n}\ncatch e\n{\n    throw e\n}\ntry\n{\n    f()\n}\ncatch _\n{\n    g()\n}"
+	if got := joinExprs(block); got != expect {
+		t.Errorf("try parse error, got:\n%s", got)
+	}
+	for _, input := range []string{"try f()", "try { f() } e", "try f() catch { g() }", "throw"} {
+		p := New(lexer.New(bytes.NewBufferString(input)))
+		p.ParseProgram()
+		if len(p.Errors) == 0 {
+			t.Errorf("expect parse error for %s", input)
+		}
+	}
+}
+
 func TestIndexExpr(t *testing.T) {
 	//block :=
 	simpleTestParse(t, `
@@ -132,6 +313,86 @@ for i := 1; i < 10; i = 1 {
 	//fmt.Println(block.String(0))
 }
 
+func TestFuncParameters(t *testing.T) {
+	block := simpleTestParse(t, `
+f := func(a, b = a + 1, ...rest) a
+f(...args, 1, ...[2, 3])
+`)
+	expect := "f := func(a, b = (a + 1), ...rest)[]\n    {\n        a\n    }\nf(...args, 1, ...pack[2, 3])"
+	if got := joinExprs(block); got != expect {
+		t.Errorf("func parameters parse error, got:\n%s", got)
+	}
+	fn := block.Exprs[0].(*DeclarationExpr).Value.(*FuncExpr)
+	if len(fn.Parameters) != 3 || fn.Parameters[1].Default == nil || !fn.Parameters[2].IsRest {
+		t.Errorf("unexpected parameters %v", fn.Parameters)
+	}
+	for _, input := range []string{"func(...a, b) 1", "func(1) 1", "func(...a.b) 1", "func(a.b = 1) 1"} {
+		p := New(lexer.New(bytes.NewBufferString(input)))
+		p.ParseProgram()
+		if len(p.Errors) == 0 {
+			t.Errorf("expect parse error for %s", input)
+		}
+	}
+}
+
+func TestNamedArgs(t *testing.T) {
+	block := simpleTestParse(t, `
+connect(host, timeout = 5, retries = n + 1)
+obj:send(data = 1)
+f(t.x = 1)
+`)
+	expect := "connect(host, timeout = 5, retries = (n + 1))\nobj:send(data = 1)\nf((t.[\"x\"] = 1))"
+	if got := joinExprs(block); got != expect {
+		t.Errorf("named args parse error, got:\n%s", got)
+	}
+	call := block.Exprs[0].(*CallExpr)
+	if len(call.Parameters) != 1 || len(call.NamedArgs) != 2 || call.NamedArgs[1].Name.Ident != "retries" {
+		t.Errorf("unexpected call args %s", call.String(0))
+	}
+	for _, input := range []string{"f(a = 1, 2)", "f(a = 1, ...rest)", "o:m(a = 1, b)"} {
+		p := New(lexer.New(bytes.NewBufferString(input)))
+		p.ParseProgram()
+		if len(p.Errors) == 0 {
+			t.Errorf("expect parse error for %s", input)
+		}
+	}
+}
+
+func TestForInExpr(t *testing.T) {
+	block := simpleTestParse(t, `
+for v in items { f(v) }
+for k, v in t f(k, v)
+gen := func() { yield 1; yield }
+`)
+	expect := "for v in items\n{\n    f(v)\n}\nfor k, v in t\n{\n    f(k, v)\n}\ngen := func()[]\n    {\n        yield 1\n        yield\n    }"
+	if got := joinExprs(block); got != expect {
+		t.Errorf("for in parse error, got:\n%s", got)
+	}
+	gen := block.Exprs[2].(*DeclarationExpr).Value.(*FuncExpr)
+	if !gen.IsGenerator {
+		t.Errorf("expect generator function")
+	}
+	nested := simpleTestParse(t, `func() { func() yield 1 }`).Exprs[0].(*FuncExpr)
+	if nested.IsGenerator || !nested.Body.Exprs[0].(*FuncExpr).IsGenerator {
+		t.Errorf("yield should only mark the innermost function")
+	}
+	interp := simpleTestParse(t, `func() { s := "a${yield 1}" }`).Exprs[0].(*FuncExpr)
+	if !interp.IsGenerator {
+		t.Errorf("yield in string interpolation should mark the function as generator")
+	}
+	inner := simpleTestParse(t, `func() "${func() yield 1}"`).Exprs[0].(*FuncExpr)
+	if inner.IsGenerator {
+		t.Errorf("yield in a function inside string interpolation should not mark the outer function")
+	}
+	for _, input := range []string{"yield 1", `"${yield 1}"`, "for a, 1 in t {}", "for a, b t {}"} {
+		p := New(lexer.New(bytes.NewBufferString(input)))
+		p.ParseProgram()
+		if len(p.Errors) == 0 {
+			t.Errorf("expect parse error for %s", input)
+		}
+	}
+}
+
 func TestPackExpr(t *testing.T) {
 	//block :=
 	simpleTestParse(t, `
@@ -155,3 +416,14 @@ func simpleTestParse(t *testing.T, input string) *BlockExpr {
 	}
 	return block
 }
+
+func joinExprs(block *BlockExpr) string {
+	buf := bytes.Buffer{}
+	for i, expr := range block.Exprs {
+		if i != 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString(expr.String(0))
+	}
+	return buf.String()
+}